@@ -0,0 +1,213 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package gio
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SlowPolicy defines what Broadcast does when a reader's buffer is full
+type SlowPolicy int
+
+const (
+	// Block blocks the Write until all readers have a free space
+	Block SlowPolicy = iota
+	// DropOldest drops the oldest items from a reader's buffer
+	DropOldest
+	// Disconnect unsubscribes the slow reader. It reads the buffered items and
+	// then gets ErrSlowReader.
+	Disconnect
+)
+
+// ErrSlowReader is returned to a reader disconnected by a Disconnect policy
+var ErrSlowReader = errors.New("gio: slow reader disconnected")
+
+// Broadcast delivers every written item to all subscribed readers. Unlike
+// Pipe, each reader has its own buffer of a given size, so readers do not
+// compete for the data. Items written when there are no readers are lost.
+//
+// Readers can Subscribe and Close while a writer is running. It is safe to
+// call Write in parallel with Read or with Close, however parallel Writes
+// may interleave.
+type Broadcast[T any] struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	size   int
+	policy SlowPolicy
+	subs   map[*BroadcastReader[T]]struct{}
+	closed bool
+	err    error
+}
+
+// NewBroadcast creates a Broadcast with a per reader buffer of size items
+func NewBroadcast[T any](size int, policy SlowPolicy) *Broadcast[T] {
+	if size < 1 {
+		size = 1
+	}
+	b := &Broadcast[T]{
+		size:   size,
+		policy: policy,
+		subs:   make(map[*BroadcastReader[T]]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Subscribe returns a new reader getting all items written from now on
+func (b *Broadcast[T]) Subscribe() *BroadcastReader[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := &BroadcastReader[T]{b: b}
+	if b.closed {
+		r.err = b.err
+		r.done = true
+		return r
+	}
+	b.subs[r] = struct{}{}
+	return r
+}
+
+// Write writes data to all subscribed readers. It blocks with a Block
+// policy until all readers have a space in their buffers. Close interrupts a
+// blocked Write, which then returns the number of items delivered to the
+// reader it waited for and io.ErrClosedPipe. Other readers may have got all
+// of the data or none.
+func (b *Broadcast[T]) Write(data []T) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	for r := range b.subs {
+		switch b.policy {
+		case Block:
+			for rest := data; len(rest) > 0; {
+				for len(r.buf) >= b.size && !r.closed && !b.closed {
+					b.cond.Wait()
+				}
+				if r.closed {
+					break
+				}
+				if b.closed {
+					return len(data) - len(rest), io.ErrClosedPipe
+				}
+				n := min(b.size-len(r.buf), len(rest))
+				r.buf = append(r.buf, rest[:n]...)
+				rest = rest[n:]
+				b.cond.Broadcast()
+			}
+		case DropOldest:
+			r.buf = append(r.buf, data...)
+			if drop := len(r.buf) - b.size; drop > 0 {
+				r.pop(drop)
+				r.dropped += drop
+			}
+		case Disconnect:
+			if len(r.buf)+len(data) > b.size {
+				delete(b.subs, r)
+				r.done = true
+				r.err = ErrSlowReader
+				continue
+			}
+			r.buf = append(r.buf, data...)
+		}
+	}
+	b.cond.Broadcast()
+	return len(data), nil
+}
+
+// Close closes the writer; readers read all buffered items and then
+// get io.EOF.
+func (b *Broadcast[T]) Close() error {
+	return b.CloseWithError(nil)
+}
+
+// CloseWithError closes the writer; readers read all buffered items and
+// then get the error err, or EOF if err is nil.
+//
+// CloseWithError never overwrites the previous error if it exists
+// and always returns nil.
+func (b *Broadcast[T]) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.err = err
+	for r := range b.subs {
+		r.done = true
+		r.err = err
+	}
+	b.subs = nil
+	b.cond.Broadcast()
+	return nil
+}
+
+// Len returns a number of subscribed readers
+func (b *Broadcast[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// A BroadcastReader is a reader subscribed to a Broadcast
+type BroadcastReader[T any] struct {
+	b       *Broadcast[T]
+	buf     []T
+	dropped int
+	done    bool // no more items will come
+	closed  bool // closed by a reader
+	err     error
+}
+
+// Read reads buffered items, blocking until a writer writes more or the
+// Broadcast is closed.
+func (r *BroadcastReader[T]) Read(data []T) (int, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	for len(r.buf) == 0 && !r.done {
+		r.b.cond.Wait()
+	}
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n := copy(data, r.buf)
+	r.pop(n)
+	r.b.cond.Broadcast()
+	return n, nil
+}
+
+// Dropped returns how many items were dropped by a DropOldest policy
+func (r *BroadcastReader[T]) Dropped() int {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	return r.dropped
+}
+
+// Close unsubscribes the reader, the buffered items are discarded
+func (r *BroadcastReader[T]) Close() error {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	delete(r.b.subs, r)
+	r.closed = true
+	r.done = true
+	r.buf = nil
+	r.b.cond.Broadcast()
+	return nil
+}
+
+func (r *BroadcastReader[T]) pop(n int) {
+	clear(r.buf[:n])
+	r.buf = r.buf[n:]
+}
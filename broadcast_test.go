@@ -0,0 +1,153 @@
+package gio_test
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio"
+)
+
+func readAll[T any](t *testing.T, r Reader[T]) ([]T, error) {
+	t.Helper()
+	var ret []T
+	buf := make([]T, 3)
+	for {
+		n, err := r.Read(buf)
+		ret = append(ret, buf[:n]...)
+		if err != nil {
+			return ret, err
+		}
+	}
+}
+
+func TestBroadcastBlock(t *testing.T) {
+	b := NewBroadcast[int](2, Block)
+	r1 := b.Subscribe()
+	r2 := b.Subscribe()
+	require.Equal(t, 2, b.Len())
+
+	var wg sync.WaitGroup
+	results := make([][]int, 2)
+	for idx, r := range []*BroadcastReader[int]{r1, r2} {
+		wg.Add(1)
+		go func(idx int, r *BroadcastReader[int]) {
+			defer wg.Done()
+			data, err := readAll[int](t, r)
+			require.ErrorIs(t, err, io.EOF)
+			results[idx] = data
+		}(idx, r)
+	}
+
+	for i := 0; i < 10; i += 2 {
+		n, err := b.Write([]int{i, i + 1})
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+	}
+	require.NoError(t, b.Close())
+	wg.Wait()
+
+	expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	require.Equal(t, expected, results[0])
+	require.Equal(t, expected, results[1])
+
+	_, err := b.Write([]int{42})
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestBroadcastDropOldest(t *testing.T) {
+	b := NewBroadcast[int](2, DropOldest)
+	r := b.Subscribe()
+	_, err := b.Write([]int{1, 2, 3, 4})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	data, err := readAll[int](t, r)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []int{3, 4}, data)
+	require.Equal(t, 2, r.Dropped())
+}
+
+func TestBroadcastDisconnect(t *testing.T) {
+	b := NewBroadcast[int](2, Disconnect)
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+
+	_, err := b.Write([]int{1, 2})
+	require.NoError(t, err)
+	data := make([]int, 2)
+	n, err := fast.Read(data)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	_, err = b.Write([]int{3})
+	require.NoError(t, err)
+	require.Equal(t, 1, b.Len())
+	require.NoError(t, b.CloseWithError(io.ErrUnexpectedEOF))
+
+	got, err := readAll[int](t, slow)
+	require.ErrorIs(t, err, ErrSlowReader)
+	require.Equal(t, []int{1, 2}, got)
+
+	got, err = readAll[int](t, fast)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, []int{3}, got)
+}
+
+func TestBroadcastUnsubscribe(t *testing.T) {
+	b := NewBroadcast[int](1, Block)
+	r := b.Subscribe()
+	_, err := b.Write([]int{1})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// blocks until r is closed
+		_, err := b.Write([]int{2})
+		require.NoError(t, err)
+	}()
+	require.NoError(t, r.Close())
+	<-done
+
+	_, err = r.Read(make([]int, 1))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.Equal(t, 0, b.Len())
+
+	late := b.Subscribe()
+	_, err = b.Write([]int{3})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	got, err := readAll[int](t, late)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []int{3}, got)
+}
+
+func TestBroadcastCloseBlocked(t *testing.T) {
+	b := NewBroadcast[int](2, Block)
+	r := b.Subscribe()
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		// blocks after two items fill the buffer
+		n, err := b.Write([]int{1, 2, 3, 4, 5})
+		done <- result{n: n, err: err}
+	}()
+	// let the Write fill the buffer
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, b.Close())
+	res := <-done
+	require.ErrorIs(t, res.err, io.ErrClosedPipe)
+	require.Equal(t, 2, res.n)
+
+	got, err := readAll[int](t, r)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []int{1, 2}, got)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package gio
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Encoder is the interface that wraps the basic Encode method.
+//
+// Encode writes the value to an underlying stream.
+type Encoder[T any] interface {
+	Encode(v T) error
+}
+
+// Decoder is the interface that wraps the basic Decode method.
+//
+// Decode reads the next value from an underlying stream and stores it in
+// v. It returns io.EOF at the end of the stream.
+type Decoder[T any] interface {
+	Decode(v *T) error
+}
+
+// Codec creates encoders and decoders, so values of type T can be stored in
+// files or sent over a byte stream.
+type Codec[T any] interface {
+	NewEncoder(w io.Writer) Encoder[T]
+	NewDecoder(r io.Reader) Decoder[T]
+}
+
+// GobCodec is a Codec using encoding/gob
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) NewEncoder(w io.Writer) Encoder[T] {
+	return gobEncoder[T]{enc: gob.NewEncoder(w)}
+}
+
+func (GobCodec[T]) NewDecoder(r io.Reader) Decoder[T] {
+	return gobDecoder[T]{dec: gob.NewDecoder(r)}
+}
+
+type gobEncoder[T any] struct {
+	enc *gob.Encoder
+}
+
+func (e gobEncoder[T]) Encode(v T) error {
+	return e.enc.Encode(v)
+}
+
+type gobDecoder[T any] struct {
+	dec *gob.Decoder
+}
+
+func (d gobDecoder[T]) Decode(v *T) error {
+	// gob does not transmit zero fields, so decode to a zero value
+	var zero T
+	*v = zero
+	return d.dec.Decode(v)
+}
+
+// JSONCodec is a Codec using encoding/json with one value per line
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) NewEncoder(w io.Writer) Encoder[T] {
+	return jsonEncoder[T]{enc: json.NewEncoder(w)}
+}
+
+func (JSONCodec[T]) NewDecoder(r io.Reader) Decoder[T] {
+	return jsonDecoder[T]{dec: json.NewDecoder(r)}
+}
+
+type jsonEncoder[T any] struct {
+	enc *json.Encoder
+}
+
+func (e jsonEncoder[T]) Encode(v T) error {
+	return e.enc.Encode(v)
+}
+
+type jsonDecoder[T any] struct {
+	dec *json.Decoder
+}
+
+func (d jsonDecoder[T]) Decode(v *T) error {
+	var zero T
+	*v = zero
+	return d.dec.Decode(v)
+}
@@ -0,0 +1,55 @@
+package gio_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio"
+)
+
+type record struct {
+	Name  string
+	Count int
+}
+
+func TestCodec(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		codec Codec[record]
+	}{
+		{"gob", GobCodec[record]{}},
+		{"json", JSONCodec[record]{}},
+	}
+	input := []record{{Name: "a", Count: 1}, {Name: "b"}, {Count: 3}}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			enc := tt.codec.NewEncoder(&buf)
+			for _, r := range input {
+				require.NoError(t, enc.Encode(r))
+			}
+
+			dec := tt.codec.NewDecoder(&buf)
+			var got []record
+			// reuse a value, so zero fields must be reset by decoder
+			var r record
+			for {
+				err := dec.Decode(&r)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, r)
+			}
+			require.Equal(t, input, got)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Envelope carries an item with its acknowledgement, so a sink can tell a
+// source the item was durably handled. Filters must pass the envelope with
+// the item via With or Split, and Ack envelopes they drop.
+//
+// Ack and Nack can be called more times, only the first call counts.
+type Envelope[T any] struct {
+	Item T
+	ack  acker
+}
+
+// NewEnvelope returns an envelope without a Tracker, Ack and Nack do nothing
+func NewEnvelope[T any](item T) Envelope[T] {
+	return Envelope[T]{Item: item}
+}
+
+// Ack marks the item as handled
+func (e Envelope[T]) Ack() {
+	if e.ack != nil {
+		e.ack.ack()
+	}
+}
+
+// Nack marks the item as failed, so a Tracker never commits its position
+// and the item is processed again after a restart
+func (e Envelope[T]) Nack(reason error) {
+	if e.ack != nil {
+		e.ack.nack(reason)
+	}
+}
+
+// With returns an envelope with a new item sharing the acknowledgement of e,
+// so map like filters can change an item type
+func With[T, U any](e Envelope[T], item U) Envelope[U] {
+	return Envelope[U]{Item: item, ack: e.ack}
+}
+
+// Split returns an envelope for each item. The e is acked when all of them
+// are acked and nacked when any of them is nacked. Split without items acks
+// e.
+func Split[T, U any](e Envelope[T], items ...U) []Envelope[U] {
+	if len(items) == 0 {
+		e.Ack()
+		return nil
+	}
+	if e.ack == nil {
+		ret := make([]Envelope[U], len(items))
+		for idx, item := range items {
+			ret[idx] = NewEnvelope(item)
+		}
+		return ret
+	}
+	group := &splitGroup{parent: e.ack}
+	group.remaining.Store(int64(len(items)))
+	ret := make([]Envelope[U], len(items))
+	for idx, item := range items {
+		ret[idx] = Envelope[U]{Item: item, ack: &splitPart{group: group}}
+	}
+	return ret
+}
+
+type acker interface {
+	ack()
+	nack(reason error)
+}
+
+type splitGroup struct {
+	parent    acker
+	remaining atomic.Int64
+}
+
+type splitPart struct {
+	group *splitGroup
+	done  atomic.Bool
+}
+
+func (p *splitPart) ack() {
+	if p.done.Swap(true) {
+		return
+	}
+	if p.group.remaining.Add(-1) == 0 {
+		p.group.parent.ack()
+	}
+}
+
+func (p *splitPart) nack(reason error) {
+	if p.done.Swap(true) {
+		return
+	}
+	p.group.parent.nack(reason)
+}
+
+// Tracker tracks envelopes created by a source and computes a committed
+// position. It is the position of the last item for which the item itself
+// and all items before it were acked. A source reading from a file can store
+// it and seek to it after a crash, so no item is lost. Items after it might
+// be processed twice, which makes it an at-least-once delivery.
+//
+//	tracker := pipe.NewTracker(offset).OnCommit(store)
+//	env := pipe.Track(tracker, offset+int64(len(line)), line)
+//
+// A nacked item stops the committed position forever, Err returns the reason.
+// Items tracked after the nack are only counted, so the memory does not grow.
+type Tracker struct {
+	mu         sync.Mutex
+	pending    []*trackEntry
+	unresolved int
+	committed  int64
+	err        error
+	onCommit   func(position int64)
+	changed    chan struct{}
+}
+
+// NewTracker returns a tracker with an initial committed position, usually
+// the one a source resumes from
+func NewTracker(committed int64) *Tracker {
+	return &Tracker{committed: committed, changed: make(chan struct{})}
+}
+
+// OnCommit sets a callback called each time the committed position moves.
+// It is called with a tracker lock held, so calls are ordered, but it must
+// not call the tracker.
+func (t *Tracker) OnCommit(fn func(position int64)) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onCommit = fn
+	return t
+}
+
+// Track wraps an item to an envelope tracked by t. Position must grow with
+// each call, it is a position a source resumes from when the item and all
+// items before it are handled.
+func Track[T any](t *Tracker, position int64, item T) Envelope[T] {
+	entry := &trackEntry{tracker: t, position: position}
+	t.mu.Lock()
+	if t.err == nil {
+		t.pending = append(t.pending, entry)
+	}
+	t.unresolved++
+	t.mu.Unlock()
+	return Envelope[T]{Item: item, ack: entry}
+}
+
+// Committed returns the committed position
+func (t *Tracker) Committed() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+// Pending returns a number of items neither acked nor nacked
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unresolved
+}
+
+// Err returns a reason of the first nacked item
+func (t *Tracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Wait blocks until all tracked items are acked or nacked and returns Err
+func (t *Tracker) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.unresolved == 0 {
+			err := t.err
+			t.mu.Unlock()
+			return err
+		}
+		changed := t.changed
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// resolve marks an entry as acked or nacked and moves the committed position
+func (t *Tracker) resolve(entry *trackEntry, reason error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry.resolved = true
+	entry.failed = reason != nil
+	t.unresolved--
+	if entry.failed && t.err == nil {
+		t.err = reason
+		// the position can't move past the failed entry, so entries after it
+		// are not needed
+		if idx := slices.Index(t.pending, entry); idx >= 0 {
+			clear(t.pending[idx+1:])
+			t.pending = t.pending[:idx+1]
+		}
+	}
+
+	moved := false
+	for len(t.pending) > 0 && t.pending[0].resolved && !t.pending[0].failed {
+		t.committed = t.pending[0].position
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+		moved = true
+	}
+	if len(t.pending) > 0 && t.pending[0].failed {
+		// the committed position is stopped forever
+		t.pending = nil
+	}
+	if moved && t.onCommit != nil {
+		t.onCommit(t.committed)
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+type trackEntry struct {
+	tracker  *Tracker
+	position int64
+	once     sync.Once
+	resolved bool
+	failed   bool
+}
+
+func (e *trackEntry) ack() {
+	e.once.Do(func() { e.tracker.resolve(e, nil) })
+}
+
+func (e *trackEntry) nack(reason error) {
+	if reason == nil {
+		reason = errors.New("pipe: nack")
+	}
+	e.once.Do(func() { e.tracker.resolve(e, reason) })
+}
+
+// AckAll is a pass-through filter which acks envelopes once they are
+// written to stdout, so it is the last stage of a pipeline writing to a
+// durable sink
+func AckAll[T any]() Filter[Envelope[T]] {
+	return Name[Envelope[T]]("ack", FilterFunc[Envelope[T]](func(ctx context.Context, stdio StandardIO[Envelope[T]]) error {
+		buf := make([]Envelope[T], 512)
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := stdio.Stdin().Read(buf)
+			if n > 0 {
+				if _, werr := stdio.Stdout().Write(buf[:n]); werr != nil {
+					return werr
+				}
+			}
+			for _, e := range buf[:n] {
+				e.Ack()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}))
+}
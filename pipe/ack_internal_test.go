@@ -0,0 +1,41 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerNackPending(t *testing.T) {
+	t.Parallel()
+	tracker := NewTracker(0)
+	a := Track(tracker, 10, "a")
+	b := Track(tracker, 20, "b")
+	c := Track(tracker, 30, "c")
+
+	// entries after the failed one are dropped
+	b.Nack(errors.New("boom"))
+	require.Len(t, tracker.pending, 2)
+	for i := 0; i < 100; i++ {
+		Track(tracker, int64(40+i), "d").Ack()
+	}
+	require.Len(t, tracker.pending, 2)
+
+	// entries before the failed one still move the position
+	a.Ack()
+	require.EqualValues(t, 10, tracker.Committed())
+	require.Empty(t, tracker.pending)
+
+	e := Track(tracker, 200, "e")
+	require.Empty(t, tracker.pending)
+	require.Equal(t, 2, tracker.Pending())
+	c.Ack()
+	e.Ack()
+	require.Equal(t, 0, tracker.Pending())
+	require.EqualValues(t, 10, tracker.Committed())
+}
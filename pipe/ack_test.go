@@ -0,0 +1,108 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+	var commits []int64
+	tracker := NewTracker(0).OnCommit(func(position int64) { commits = append(commits, position) })
+
+	a := Track(tracker, 10, "a")
+	b := Track(tracker, 20, "b")
+	c := Track(tracker, 30, "c")
+	require.Equal(t, 3, tracker.Pending())
+
+	b.Ack()
+	require.EqualValues(t, 0, tracker.Committed())
+	a.Ack()
+	a.Ack()
+	require.EqualValues(t, 20, tracker.Committed())
+
+	parts := Split(c, 1, 2)
+	parts[0].Ack()
+	require.EqualValues(t, 20, tracker.Committed())
+	With(parts[1], "two").Ack()
+	require.EqualValues(t, 30, tracker.Committed())
+	require.Equal(t, []int64{20, 30}, commits)
+	require.NoError(t, tracker.Wait(context.Background()))
+
+	boom := errors.New("boom")
+	d := Track(tracker, 40, "d")
+	e := Track(tracker, 50, "e")
+	e.Ack()
+	Split(d, "d1", "d2")[1].Nack(boom)
+	require.EqualValues(t, 30, tracker.Committed())
+	require.Equal(t, 0, tracker.Pending())
+	require.ErrorIs(t, tracker.Wait(context.Background()), boom)
+	require.ErrorIs(t, tracker.Err(), boom)
+
+	// empty split acks the envelope
+	Split[string, int](Track(tracker, 60, "f"))
+	require.Equal(t, 0, tracker.Pending())
+
+	// untracked envelopes are noop
+	NewEnvelope("x").Ack()
+	NewEnvelope("x").Nack(boom)
+}
+
+// Source wraps lines to tracked envelopes, position is an offset after a line
+type Source struct {
+	tracker *Tracker
+	lines   []string
+}
+
+func (s Source) Run(ctx context.Context, stdio StandardIO[Envelope[string]]) error {
+	offset := s.tracker.Committed()
+	for _, line := range s.lines {
+		offset += int64(len(line))
+		if _, err := stdio.Stdout().Write([]Envelope[string]{Track(s.tracker, offset, line)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type envelopeBuffer struct {
+	s strings.Builder
+}
+
+func (b *envelopeBuffer) Write(p []Envelope[string]) (int, error) {
+	for _, e := range p {
+		b.s.WriteString(e.Item)
+	}
+	return len(p), nil
+}
+
+type envelopeReader struct{}
+
+func (envelopeReader) Read([]Envelope[string]) (int, error) {
+	return 0, io.EOF
+}
+
+func TestAckAll(t *testing.T) {
+	t.Parallel()
+	tracker := NewTracker(0)
+	out := &envelopeBuffer{}
+	stdio := NewStdio[Envelope[string]](envelopeReader{}, out, os.Stderr)
+	source := Source{tracker: tracker, lines: []string{"one\n", "two\n", "three\n"}}
+	err := NewLine[Envelope[string]]().Run(context.Background(), stdio, source, AckAll[string]())
+	require.NoError(t, err)
+	require.NoError(t, tracker.Wait(context.Background()))
+	require.EqualValues(t, 14, tracker.Committed())
+	require.Equal(t, "one\ntwo\nthree\n", out.s.String())
+}
@@ -0,0 +1,398 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomoni/gio"
+)
+
+// Snapshotter is implemented by sources and stateful filters which can be
+// checkpointed. Snapshot is called from the goroutine of a filter, inside
+// its Read or Write call, so it does not need a synchronization with Run.
+// This holds only for filters reading stdin on the goroutine of Run, others
+// must implement AsyncReader. Restore is called before Run.
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore([]byte) error
+}
+
+// AsyncReader is implemented by filters which read stdin on another goroutine
+// than Run, like Parallel or filters.Batch. A checkpoint barrier is read on
+// that goroutine while the filter still holds earlier items, so such stages
+// can't be checkpointed and Line rejects them in a checkpoint mode.
+type AsyncReader interface {
+	ReadsAsync() bool
+}
+
+// CheckpointEveryWrite used as Line.Checkpoint every saves a checkpoint after
+// each Write of the first stage. Each Save of DirStore syncs a file, so it is
+// slow and meant mostly for tests.
+const CheckpointEveryWrite time.Duration = -1
+
+// StageState is a snapshot of one stage
+type StageState struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	State []byte `json:"state"`
+}
+
+// Checkpoint is a consistent snapshot of all Snapshotter stages of a line
+type Checkpoint struct {
+	ID     uint64       `json:"id"`
+	Time   time.Time    `json:"time"`
+	Stages []StageState `json:"stages"`
+}
+
+// CheckpointStore persists the last checkpoint. Load returns false if there
+// is no checkpoint.
+type CheckpointStore interface {
+	Save(Checkpoint) error
+	Load() (Checkpoint, bool, error)
+	Clear() error
+}
+
+// DirStore stores a checkpoint as a JSON file in a directory. Save writes
+// a temporary file and renames it, so a crash never leaves a partial
+// checkpoint.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) DirStore {
+	return DirStore{dir: dir}
+}
+
+const checkpointFile = "checkpoint.json"
+
+func (s DirStore) Save(cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, checkpointFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, checkpointFile))
+}
+
+func (s DirStore) Load() (Checkpoint, bool, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(filepath.Join(s.dir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, false, nil
+	} else if err != nil {
+		return cp, false, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, false, err
+	}
+	return cp, true, nil
+}
+
+func (s DirStore) Clear() error {
+	err := os.Remove(filepath.Join(s.dir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// readsAsync returns true if a filter or any wrapped filter reads
+// asynchronously
+func readsAsync(filter any) bool {
+	for filter != nil {
+		if a, ok := filter.(AsyncReader); ok && a.ReadsAsync() {
+			return true
+		}
+		u, ok := filter.(interface{ Unwrap() any })
+		if !ok {
+			return false
+		}
+		filter = u.Unwrap()
+	}
+	return false
+}
+
+// snapshotter returns a Snapshotter of a filter, which can be wrapped
+func snapshotter(filter any) (Snapshotter, bool) {
+	for filter != nil {
+		if s, ok := filter.(Snapshotter); ok {
+			return s, true
+		}
+		u, ok := filter.(interface{ Unwrap() any })
+		if !ok {
+			return nil, false
+		}
+		filter = u.Unwrap()
+	}
+	return nil, false
+}
+
+// checkpointer runs checkpoints of one Line.Run. The first stage starts a
+// checkpoint after its Write by snapshotting itself and sending a barrier
+// downstream. Each stage snapshots itself when it reads the barrier, so its
+// state reflects all items before the barrier. The checkpoint is saved when
+// the barrier passes the last stage.
+type checkpointer[T any] struct {
+	store   CheckpointStore
+	every   time.Duration
+	filters []Filter[T]
+	stop    chan struct{}
+	due     atomic.Bool
+
+	mu       sync.Mutex
+	id       uint64
+	inFlight bool
+	current  Checkpoint
+}
+
+func newCheckpointer[T any](store CheckpointStore, every time.Duration, filters []Filter[T]) *checkpointer[T] {
+	return &checkpointer[T]{store: store, every: every, filters: filters, stop: make(chan struct{})}
+}
+
+// validate rejects a zero every and stages which can't be checkpointed
+func (c *checkpointer[T]) validate() error {
+	if c.every == 0 {
+		return errors.New("pipe: checkpoint: every must be positive or CheckpointEveryWrite")
+	}
+	for idx, filter := range c.filters {
+		if readsAsync(filter) {
+			return fmt.Errorf("pipe: checkpoint: stage %d %q reads asynchronously", idx, FilterName(filter))
+		}
+	}
+	return nil
+}
+
+// restore loads the last checkpoint and restores all stages
+func (c *checkpointer[T]) restore() error {
+	cp, ok, err := c.store.Load()
+	if err != nil || !ok {
+		return err
+	}
+	for _, st := range cp.Stages {
+		if st.Index >= len(c.filters) || FilterName(c.filters[st.Index]) != st.Name {
+			return fmt.Errorf("pipe: checkpoint %d does not match the line: stage %d %q", cp.ID, st.Index, st.Name)
+		}
+		s, ok := snapshotter(c.filters[st.Index])
+		if !ok {
+			return fmt.Errorf("pipe: checkpoint %d: stage %d %q is not a Snapshotter", cp.ID, st.Index, st.Name)
+		}
+		if err := s.Restore(st.State); err != nil {
+			return fmt.Errorf("pipe: checkpoint %d: restore stage %d %q: %w", cp.ID, st.Index, st.Name, err)
+		}
+	}
+	c.id = cp.ID
+	return nil
+}
+
+// start periodically marks a checkpoint as due
+func (c *checkpointer[T]) start() {
+	if c.every <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.due.Store(true)
+			}
+		}
+	}()
+}
+
+func (c *checkpointer[T]) close() {
+	close(c.stop)
+}
+
+// begin starts a new checkpoint if it is due and none is in flight
+func (c *checkpointer[T]) begin() (uint64, bool) {
+	if c.every > 0 && !c.due.Load() {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight {
+		return 0, false
+	}
+	c.due.Store(false)
+	c.inFlight = true
+	c.id++
+	c.current = Checkpoint{ID: c.id, Time: time.Now()}
+	return c.id, true
+}
+
+// snapshot adds a state of a stage to the checkpoint in flight
+func (c *checkpointer[T]) snapshot(stage int) error {
+	s, ok := snapshotter(c.filters[stage])
+	if !ok {
+		return nil
+	}
+	state, err := s.Snapshot()
+	if err != nil {
+		return fmt.Errorf("pipe: checkpoint: snapshot: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current.Stages = append(c.current.Stages, StageState{Index: stage, Name: FilterName(c.filters[stage]), State: state})
+	return nil
+}
+
+// complete saves the checkpoint, when a barrier passed the last stage
+func (c *checkpointer[T]) complete(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight = false
+	if id != c.current.ID {
+		return nil
+	}
+	if err := c.store.Save(c.current); err != nil {
+		return fmt.Errorf("pipe: checkpoint: save: %w", err)
+	}
+	return nil
+}
+
+// connect returns stdout of a stage idx and stdin of the next one
+func (c *checkpointer[T]) connect(idx int, in gio.ReadCloser[T], isLast bool, stdout gio.Writer[T]) (gio.WriteCloser[T], gio.ReadCloser[T]) {
+	out := &barrierW[T]{cp: c, stage: idx}
+	var nextIn gio.ReadCloser[T]
+	if isLast {
+		out.w = nopCloseW[T]{w: stdout}
+	} else {
+		pr, pw := gio.Pipe[frame[T]]()
+		out.pw = pw
+		nextIn = &barrierR[T]{cp: c, stage: idx + 1, pr: pr}
+	}
+	if r, ok := in.(*barrierR[T]); ok {
+		r.out = out
+	}
+	return out, nextIn
+}
+
+// frame is sent via a pipe between stages in a checkpoint mode, it carries
+// either items or a barrier
+type frame[T any] struct {
+	items   []T
+	barrier uint64
+}
+
+// barrierW writes frames to the next stage, or items to the line stdout
+// for the last stage
+type barrierW[T any] struct {
+	cp    *checkpointer[T]
+	stage int
+	pw    *gio.PipeWriter[frame[T]]
+	w     gio.WriteCloser[T]
+}
+
+func (b *barrierW[T]) Write(items []T) (int, error) {
+	var n int
+	var err error
+	if b.pw != nil {
+		// a reader holds items after Write returns, so they must be copied
+		_, err = b.pw.Write([]frame[T]{{items: slices.Clone(items)}})
+		if err == nil {
+			n = len(items)
+		}
+	} else {
+		n, err = b.w.Write(items)
+	}
+	if err != nil || b.stage != 0 {
+		return n, err
+	}
+	if id, ok := b.cp.begin(); ok {
+		if err := b.cp.snapshot(b.stage); err != nil {
+			return n, err
+		}
+		if err := b.barrier(id); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// barrier passes a barrier downstream
+func (b *barrierW[T]) barrier(id uint64) error {
+	if b.pw == nil {
+		return b.cp.complete(id)
+	}
+	_, err := b.pw.Write([]frame[T]{{barrier: id}})
+	return err
+}
+
+func (b *barrierW[T]) Close() error {
+	if b.pw != nil {
+		return b.pw.Close()
+	}
+	return b.w.Close()
+}
+
+// barrierR reads frames from the previous stage. On a barrier it snapshots
+// the stage and passes the barrier to out.
+type barrierR[T any] struct {
+	cp    *checkpointer[T]
+	stage int
+	pr    *gio.PipeReader[frame[T]]
+	out   *barrierW[T]
+	rest  []T
+	buf   []frame[T]
+}
+
+func (b *barrierR[T]) Read(data []T) (int, error) {
+	for len(b.rest) == 0 {
+		if b.buf == nil {
+			b.buf = make([]frame[T], 1)
+		}
+		n, err := b.pr.Read(b.buf)
+		if n == 0 {
+			return 0, err
+		}
+		f := b.buf[0]
+		b.buf[0] = frame[T]{}
+		if f.barrier == 0 {
+			b.rest = f.items
+			continue
+		}
+		if err := b.cp.snapshot(b.stage); err != nil {
+			return 0, err
+		}
+		if err := b.out.barrier(f.barrier); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(data, b.rest)
+	b.rest = b.rest[n:]
+	return n, nil
+}
+
+func (b *barrierR[T]) Close() error {
+	return b.pr.Close()
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+// Counter writes numbers from next to n
+type Counter struct {
+	N    int `json:"n"`
+	Next int `json:"next"`
+}
+
+func (c *Counter) Run(ctx context.Context, stdio StandardIO[int]) error {
+	for c.Next < c.N {
+		i := c.Next
+		c.Next++
+		if _, err := stdio.Stdout().Write([]int{i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Counter) Snapshot() ([]byte, error) { return json.Marshal(c) }
+func (c *Counter) Restore(b []byte) error    { return json.Unmarshal(b, c) }
+
+// Sum writes a sum of all items
+type Sum struct {
+	Sum int `json:"sum"`
+}
+
+func (s *Sum) Run(ctx context.Context, stdio StandardIO[int]) error {
+	buf := make([]int, 8)
+	for {
+		n, err := stdio.Stdin().Read(buf)
+		for _, x := range buf[:n] {
+			s.Sum += x
+		}
+		if errors.Is(err, io.EOF) {
+			_, err = stdio.Stdout().Write([]int{s.Sum})
+			return err
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Sum) Snapshot() ([]byte, error) { return json.Marshal(s) }
+func (s *Sum) Restore(b []byte) error    { return json.Unmarshal(b, s) }
+
+// Crash passes items and fails on item at
+type Crash struct {
+	at int
+}
+
+func (c Crash) Run(ctx context.Context, stdio StandardIO[int]) error {
+	buf := make([]int, 1)
+	for {
+		n, err := stdio.Stdin().Read(buf)
+		if n == 1 {
+			if buf[0] == c.at {
+				return errors.New("crash")
+			}
+			if _, werr := stdio.Stdout().Write(buf); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := NewDirStore(t.TempDir())
+
+	out := &IntBuffer{}
+	stdio := NewStdio[int](nil, out, os.Stderr)
+	line := NewLine[int]().Checkpoint(store, CheckpointEveryWrite)
+	err := line.Run(ctx, stdio, &Counter{N: 100}, Name[int]("crash", Crash{at: 50}), &Sum{})
+	require.Error(t, err)
+	cp, ok, err := store.Load()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, cp.Stages, 2)
+	var saved Counter
+	require.NoError(t, json.Unmarshal(cp.Stages[0].State, &saved))
+	require.True(t, saved.Next > 0 && saved.Next <= 50, saved.Next)
+
+	// restart with fresh filters restored from the checkpoint
+	out = &IntBuffer{}
+	stdio = NewStdio[int](nil, out, os.Stderr)
+	counter := &Counter{N: 100}
+	err = line.Run(ctx, stdio, counter, Name[int]("crash", Crash{at: -1}), &Sum{})
+	require.NoError(t, err)
+	require.Equal(t, []int{4950}, out.items)
+
+	_, ok, err = store.Load()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	t.Parallel()
+	store := NewDirStore(t.TempDir())
+	require.NoError(t, store.Save(Checkpoint{ID: 1, Stages: []StageState{{Index: 0, Name: "other", State: []byte("{}")}}}))
+
+	stdio := NewStdio[int](nil, &IntBuffer{}, os.Stderr)
+	err := NewLine[int]().Checkpoint(store, CheckpointEveryWrite).Run(context.Background(), stdio, &Counter{N: 1}, &Sum{})
+	require.EqualError(t, err, `Error{Code: 1, Err: pipe: checkpoint 1 does not match the line: stage 0 "other"}`)
+}
+
+func TestCheckpointInvalid(t *testing.T) {
+	t.Parallel()
+	store := NewDirStore(t.TempDir())
+	stdio := NewStdio[int](nil, &IntBuffer{}, os.Stderr)
+
+	err := NewLine[int]().Checkpoint(store, 0).Run(context.Background(), stdio, &Counter{N: 1}, &Sum{})
+	require.EqualError(t, err, `Error{Code: 1, Err: pipe: checkpoint: every must be positive or CheckpointEveryWrite}`)
+
+	parallel := Name[int]("par", NewParallel[int](2, &Sum{}))
+	err = NewLine[int]().Checkpoint(store, CheckpointEveryWrite).Run(context.Background(), stdio, &Counter{N: 1}, parallel)
+	require.EqualError(t, err, `Error{Code: 1, Err: pipe: checkpoint: stage 1 "par" reads asynchronously}`)
+}
+
+func TestDirStore(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store := NewDirStore(dir)
+	_, ok, err := store.Load()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	cp := Checkpoint{ID: 7, Stages: []StageState{{Index: 1, Name: "sum", State: []byte(`{"sum":3}`)}}}
+	require.NoError(t, store.Save(cp))
+	got, ok, err := store.Load()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, cp.Stages, got.Stages)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, store.Clear())
+	require.NoError(t, store.Clear())
+}
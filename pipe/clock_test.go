@@ -0,0 +1,39 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestManualClock(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	t1 := clock.NewTimer(time.Second)
+	t2 := clock.NewTimer(2 * time.Second)
+	t3 := clock.NewTimer(3 * time.Second)
+	require.Equal(t, 3, clock.Timers())
+	require.True(t, t3.Stop())
+	require.False(t, t3.Stop())
+
+	clock.Advance(1500 * time.Millisecond)
+	require.Equal(t, start.Add(1500*time.Millisecond), clock.Now())
+	require.Equal(t, start.Add(1500*time.Millisecond), <-t1.C())
+	require.Len(t, t2.C(), 0)
+	require.Equal(t, 1, clock.Timers())
+
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(2500*time.Millisecond), <-t2.C())
+	require.False(t, t2.Stop())
+	require.Equal(t, 0, clock.Timers())
+	require.Len(t, t3.C(), 0)
+}
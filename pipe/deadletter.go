@@ -0,0 +1,139 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gomoni/gio"
+)
+
+// ErrTooManyRejects is returned by Reject when a number of rejected items
+// exceeds Line.MaxRejects
+var ErrTooManyRejects = errors.New("pipe: too many rejected items")
+
+// DeadLetter is an item rejected by a stage with a reason
+type DeadLetter[T any] struct {
+	Stage  Stage
+	Item   T
+	Reason error
+}
+
+// DeadLetterFunc is an adapter to use ordinary function as a dead letter sink
+type DeadLetterFunc[T any] func(DeadLetter[T]) error
+
+func (f DeadLetterFunc[T]) Write(letters []DeadLetter[T]) (int, error) {
+	for idx, letter := range letters {
+		if err := f(letter); err != nil {
+			return idx, err
+		}
+	}
+	return len(letters), nil
+}
+
+// DeadLetterJSON returns a dead letter sink writing one JSON object per line
+// to w, so rejected items can be stored in a file.
+//
+//	{"stage":1,"name":"parse","item":"x","reason":"invalid syntax"}
+func DeadLetterJSON[T any](w io.Writer) gio.Writer[DeadLetter[T]] {
+	enc := json.NewEncoder(w)
+	return DeadLetterFunc[T](func(letter DeadLetter[T]) error {
+		reason := ""
+		if letter.Reason != nil {
+			reason = letter.Reason.Error()
+		}
+		return enc.Encode(struct {
+			Stage  int    `json:"stage"`
+			Name   string `json:"name"`
+			Item   T      `json:"item"`
+			Reason string `json:"reason"`
+		}{letter.Stage.Index, letter.Stage.Name, letter.Item, reason})
+	})
+}
+
+// Reject sends an item to a dead letter sink of a Line, so a filter can
+// skip an invalid item and continue. It returns an error the filter must
+// return, when a sink is not configured, the reason is returned, so the
+// stage fails as usual. It fails with ErrTooManyRejects when a limit
+// set by Line.MaxRejects is exceeded.
+//
+//	if err != nil {
+//		if err := pipe.Reject(stdio, item, err); err != nil {
+//			return err
+//		}
+//		continue
+//	}
+func Reject[T any](stdio StandardIO[T], item T, reason error) error {
+	if r, ok := stdio.(rejecter[T]); ok {
+		return r.reject(item, reason)
+	}
+	return reason
+}
+
+type rejecter[T any] interface {
+	reject(item T, reason error) error
+}
+
+// rejects routes rejected items of all stages of one run to a sink
+type rejects[T any] struct {
+	mu      sync.Mutex
+	sink    gio.Writer[DeadLetter[T]]
+	max     int
+	count   int
+	observe func(Event)
+}
+
+func (r *rejects[T]) reject(stage Stage, item T, reason error) error {
+	r.observe(Event{Kind: EventReject, Stage: stage, N: 1, Err: reason})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+	if _, err := r.sink.Write([]DeadLetter[T]{{Stage: stage, Item: item, Reason: reason}}); err != nil {
+		return fmt.Errorf("pipe: dead letter: %w", err)
+	}
+	if r.max >= 0 && r.count > r.max {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyRejects, r.count, r.max)
+	}
+	return nil
+}
+
+// forStage returns a rejecter for a stage. If r is nil, rejecter of a
+// parent stdio is used.
+func (r *rejects[T]) forStage(stage Stage, parent StandardIO[T]) rejecter[T] {
+	if r == nil {
+		if pr, ok := parent.(rejecter[T]); ok {
+			return pr
+		}
+		return nil
+	}
+	return stageRejects[T]{rejects: r, stage: stage}
+}
+
+// stageRejects binds rejects to a stage
+type stageRejects[T any] struct {
+	rejects *rejects[T]
+	stage   Stage
+}
+
+func (s stageRejects[T]) reject(item T, reason error) error {
+	return s.rejects.reject(s.stage, item, reason)
+}
+
+// derive returns Stdio with a new stdin and stdout, which inherits the rest
+// from stdio, so filters running nested filters can pass the dead letter
+// sink, additional streams and the environment down
+func derive[T any](stdio StandardIO[T], stdin gio.Reader[T], stdout gio.Writer[T]) Stdio[T] {
+	ret := NewStdio[T](stdin, stdout, stdio.Stderr())
+	if r, ok := stdio.(rejecter[T]); ok {
+		ret.rejecter = r
+	}
+	ret.extra = streamsOf(stdio)
+	ret.env = EnvironOf(stdio)
+	return ret
+}
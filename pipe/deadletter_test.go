@@ -0,0 +1,128 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+// Numbers passes numbers and rejects everything else
+type Numbers struct{}
+
+func (Numbers) Run(ctx context.Context, stdio StandardIO[string]) error {
+	buf := make([]string, 1)
+	for {
+		n, err := stdio.Stdin().Read(buf)
+		if n == 1 {
+			if _, perr := strconv.Atoi(buf[0]); perr != nil {
+				if rerr := Reject(stdio, buf[0], perr); rerr != nil {
+					return rerr
+				}
+			} else if _, werr := stdio.Stdout().Write(buf); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	numbers := Name[string]("numbers", Numbers{})
+	input := func() *StringReader {
+		return &StringReader{lines: []string{"1", "x", "2", "y", "3"}}
+	}
+
+	t.Run("sink", func(t *testing.T) {
+		t.Parallel()
+		var letters []DeadLetter[string]
+		sink := DeadLetterFunc[string](func(letter DeadLetter[string]) error {
+			letters = append(letters, letter)
+			return nil
+		})
+		metrics := NewMetrics()
+		recorder := &Recorder{}
+		out := &StringBuffer{}
+		stdio := NewStdio[string](input(), out, os.Stderr)
+
+		err := NewLine[string]().DeadLetter(sink).Observe(metrics, recorder).Run(ctx, stdio, Prefix{prefix: ""}, numbers)
+		require.NoError(t, err)
+		require.Equal(t, "123", out.String())
+		require.Len(t, letters, 2)
+		require.Equal(t, Stage{Index: 1, Name: "numbers"}, letters[0].Stage)
+		require.Equal(t, "x", letters[0].Item)
+		require.ErrorIs(t, letters[0].Reason, strconv.ErrSyntax)
+		require.Equal(t, "y", letters[1].Item)
+
+		require.EqualValues(t, 2, metrics.Snapshot()[1].Rejected)
+		require.Len(t, recorder.Events(EventReject), 2)
+	})
+
+	t.Run("no sink", func(t *testing.T) {
+		t.Parallel()
+		stdio := NewStdio[string](input(), &StringBuffer{}, os.Stderr)
+		err := NewLine[string]().Run(ctx, stdio, numbers)
+		require.ErrorIs(t, err, strconv.ErrSyntax)
+	})
+
+	t.Run("max rejects", func(t *testing.T) {
+		t.Parallel()
+		var letters []DeadLetter[string]
+		sink := DeadLetterFunc[string](func(letter DeadLetter[string]) error {
+			letters = append(letters, letter)
+			return nil
+		})
+		stdio := NewStdio[string](input(), &StringBuffer{}, os.Stderr)
+		err := NewLine[string]().DeadLetter(sink).MaxRejects(1).Run(ctx, stdio, Prefix{prefix: ""}, numbers)
+		require.Error(t, err)
+		require.ErrorIs(t, Errors(err)[1], ErrTooManyRejects)
+		require.EqualError(t, Errors(err)[1], "numbers: pipe: too many rejected items: 2 > 1")
+		require.Len(t, letters, 2)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		var sink strings.Builder
+		stdio := NewStdio[string](input(), &StringBuffer{}, os.Stderr)
+		err := NewLine[string]().DeadLetter(DeadLetterJSON[string](&sink)).Run(ctx, stdio, numbers)
+		require.NoError(t, err)
+		require.Equal(t,
+			`{"stage":0,"name":"numbers","item":"x","reason":"strconv.Atoi: parsing \"x\": invalid syntax"}`+"\n"+
+				`{"stage":0,"name":"numbers","item":"y","reason":"strconv.Atoi: parsing \"y\": invalid syntax"}`+"\n",
+			sink.String())
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		t.Parallel()
+		var letters []DeadLetter[string]
+		sink := DeadLetterFunc[string](func(letter DeadLetter[string]) error {
+			letters = append(letters, letter)
+			return nil
+		})
+		out := &StringBuffer{}
+		stdio := NewStdio[string](input(), out, os.Stderr)
+		parallel := Name[string]("parallel", NewParallel[string](2, numbers))
+		err := NewLine[string]().DeadLetter(sink).Run(ctx, stdio, Prefix{prefix: ""}, parallel)
+		require.NoError(t, err)
+		require.Equal(t, "123", out.String())
+		require.Len(t, letters, 2)
+		require.Equal(t, Stage{Index: 1, Name: "parallel"}, letters[0].Stage)
+	})
+}
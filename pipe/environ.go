@@ -0,0 +1,188 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Environ is a process like context of filters: an environment overlay, a
+// working directory, arguments and umask. It is carried by Stdio through
+// Line, so native filters can read it and unix.Cmd inherits it. A zero
+// Environ inherits everything from the running process.
+//
+//	stdio = stdio.WithEnviron(pipe.Environ{}.Setenv("LC_ALL", "C").Chdir("/tmp"))
+//
+// Environ is a value, each method returns a modified copy.
+type Environ struct {
+	vars     map[string]envVar
+	dir      string
+	args     []string
+	umask    os.FileMode
+	hasUmask bool
+}
+
+type envVar struct {
+	value string
+	unset bool
+}
+
+// Setenv sets a variable in the overlay
+func (e Environ) Setenv(key, value string) Environ {
+	return e.withVar(key, envVar{value: value})
+}
+
+// Unsetenv hides a variable of the process
+func (e Environ) Unsetenv(key string) Environ {
+	return e.withVar(key, envVar{unset: true})
+}
+
+func (e Environ) withVar(key string, v envVar) Environ {
+	vars := make(map[string]envVar, len(e.vars)+1)
+	for k, v := range e.vars {
+		vars[k] = v
+	}
+	vars[key] = v
+	e.vars = vars
+	return e
+}
+
+// LookupEnv returns a variable from the overlay or from the process
+func (e Environ) LookupEnv(key string) (string, bool) {
+	if v, ok := e.vars[key]; ok {
+		return v.value, !v.unset
+	}
+	return os.LookupEnv(key)
+}
+
+// Getenv returns a variable from the overlay or from the process
+func (e Environ) Getenv(key string) string {
+	v, _ := e.LookupEnv(key)
+	return v
+}
+
+// Environ returns the environment of the process with the overlay applied
+// in the key=value form of os.Environ
+func (e Environ) Environ() []string {
+	env := os.Environ()
+	if len(e.vars) == 0 {
+		return env
+	}
+	ret := make([]string, 0, len(env)+len(e.vars))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := e.vars[key]; !ok {
+			ret = append(ret, kv)
+		}
+	}
+	keys := make([]string, 0, len(e.vars))
+	for key := range e.vars {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if v := e.vars[key]; !v.unset {
+			ret = append(ret, key+"="+v.value)
+		}
+	}
+	return ret
+}
+
+// Chdir changes the working directory, a relative dir is relative to the
+// current one
+func (e Environ) Chdir(dir string) Environ {
+	e.dir = e.Path(dir)
+	return e
+}
+
+// Dir returns the working directory, empty is the one of the process
+func (e Environ) Dir() string {
+	return e.dir
+}
+
+// Path resolves a relative path against the working directory
+func (e Environ) Path(path string) string {
+	if e.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(e.dir, path)
+}
+
+// WithArgs sets arguments, like positional parameters of a shell
+func (e Environ) WithArgs(args ...string) Environ {
+	e.args = slices.Clone(args)
+	return e
+}
+
+// Args returns arguments
+func (e Environ) Args() []string {
+	return slices.Clone(e.args)
+}
+
+// WithUmask sets umask for files created by filters and commands. A Cmd of
+// gio/unix sets it as the process umask while a command starts, so it works
+// on unix systems only.
+func (e Environ) WithUmask(mask os.FileMode) Environ {
+	e.umask, e.hasUmask = mask&os.ModePerm, true
+	return e
+}
+
+// Umask returns umask, false means the one of the process
+func (e Environ) Umask() (os.FileMode, bool) {
+	return e.umask, e.hasUmask
+}
+
+type environer interface {
+	environ() Environ
+}
+
+func (s Stdio[T]) environ() Environ {
+	return s.env
+}
+
+// WithEnviron returns a copy of stdio with an environment e
+func (s Stdio[T]) WithEnviron(e Environ) Stdio[T] {
+	s.env = e
+	return s
+}
+
+// EnvironOf returns the environment of stdio, a zero Environ if there is
+// none
+func EnvironOf[T any](stdio StandardIO[T]) Environ {
+	if e, ok := stdio.(environer); ok {
+		return e.environ()
+	}
+	return Environ{}
+}
+
+// Scope runs a filter with a changed environment, so the change does not
+// leak to other stages, like (cd dir && cmd) in a shell.
+//
+//	pipe.Scope(func(e pipe.Environ) pipe.Environ { return e.Chdir("dir") }, filter)
+func Scope[T any](change func(Environ) Environ, filter Filter[T]) Filter[T] {
+	return scoped[T]{change: change, filter: filter}
+}
+
+type scoped[T any] struct {
+	change func(Environ) Environ
+	filter Filter[T]
+}
+
+func (s scoped[T]) Name() string {
+	return "(" + FilterName(s.filter) + ")"
+}
+
+func (s scoped[T]) Unwrap() any {
+	return s.filter
+}
+
+func (s scoped[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	scoped := derive(stdio, stdio.Stdin(), stdio.Stdout())
+	return s.filter.Run(ctx, scoped.WithEnviron(s.change(EnvironOf(stdio))))
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("GIO_ENVIRON_A", "a")
+	t.Setenv("GIO_ENVIRON_B", "b")
+
+	var zero Environ
+	require.Equal(t, os.Environ(), zero.Environ())
+	require.Equal(t, "a", zero.Getenv("GIO_ENVIRON_A"))
+
+	e := zero.Setenv("GIO_ENVIRON_A", "x").Unsetenv("GIO_ENVIRON_B").Setenv("GIO_ENVIRON_C", "c")
+	require.Equal(t, "a", zero.Getenv("GIO_ENVIRON_A"))
+	require.Equal(t, "x", e.Getenv("GIO_ENVIRON_A"))
+	_, ok := e.LookupEnv("GIO_ENVIRON_B")
+	require.False(t, ok)
+	env := e.Environ()
+	require.Contains(t, env, "GIO_ENVIRON_A=x")
+	require.Contains(t, env, "GIO_ENVIRON_C=c")
+	require.False(t, slices.Contains(env, "GIO_ENVIRON_A=a"))
+	require.False(t, slices.Contains(env, "GIO_ENVIRON_B=b"))
+
+	e = e.Chdir("/tmp").Chdir("sub")
+	require.Equal(t, "/tmp/sub", e.Dir())
+	require.Equal(t, "/tmp/sub/f", e.Path("f"))
+	require.Equal(t, "/f", e.Path("/f"))
+	require.Equal(t, "f", zero.Path("f"))
+
+	args := []string{"a", "b"}
+	e = e.WithArgs(args...)
+	args[0] = "changed"
+	require.Equal(t, []string{"a", "b"}, e.Args())
+
+	_, ok = e.Umask()
+	require.False(t, ok)
+	mask, ok := e.WithUmask(0o077).Umask()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0o077), mask)
+}
+
+// Pwd writes a working directory of its environment
+type Pwd struct{}
+
+func (Pwd) Run(ctx context.Context, stdio StandardIO[string]) error {
+	_, err := stdio.Stdout().Write([]string{EnvironOf(stdio).Dir() + "\n"})
+	return err
+}
+
+func TestScope(t *testing.T) {
+	t.Parallel()
+	var out StringBuffer
+	stdio := NewStdio[string](nil, &out, nil).WithEnviron(Environ{}.Chdir("/tmp"))
+	cd := func(e Environ) Environ { return e.Chdir("sub") }
+	scoped := Scope[string](cd, Pwd{})
+	require.Equal(t, "(Pwd)", FilterName(scoped))
+
+	err := NewLine[string]().Run(context.Background(), stdio, FilterFunc[string](func(ctx context.Context, stdio StandardIO[string]) error {
+		if err := (Pwd{}).Run(ctx, stdio); err != nil {
+			return err
+		}
+		if err := scoped.Run(ctx, stdio); err != nil {
+			return err
+		}
+		// a nested line inherits the environment
+		return NewLine[string]().Run(ctx, stdio, Pwd{})
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "/tmp\n/tmp/sub\n/tmp\n", out.s.String())
+}
@@ -16,6 +16,9 @@ const (
 	NotExecutable = 126
 	// NotFound is from POSIX and indicate a tool was not found
 	NotFound = 127
+	// Signaled is added to a signal number for a tool terminated by a
+	// signal, like shells do, so SIGTERM gives 143
+	Signaled = 128
 	// UnknownError is a code used for unpacking other than pipe.Error
 	UnknownError = 250
 )
@@ -37,12 +40,12 @@ func (e Error) Unwrap() error {
 }
 */
 
-// Errors returns a slice of errors if err is Error and member Err implements
-// Unwrap []error otherwise returns nil even for non-nil errors
+// Errors returns a slice of errors if err is or wraps Error and member Err
+// implements Unwrap []error otherwise returns nil even for non-nil errors
 func Errors(err error) []error {
-
-	if Err, ok := err.(Error); ok {
-		if errs, ok := Err.Err.(interface{ Unwrap() []error }); ok {
+	var pipeErr Error
+	if errors.As(err, &pipeErr) {
+		if errs, ok := pipeErr.Err.(interface{ Unwrap() []error }); ok {
 			return errs.Unwrap()
 		}
 	}
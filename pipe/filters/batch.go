@@ -0,0 +1,298 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gomoni/gio"
+	"github.com/gomoni/gio/pipe"
+)
+
+// BatchFunc is called for each batch or window of items. The slice is not
+// reused, so it can be retained.
+type BatchFunc[T any] func(ctx context.Context, batch []T) error
+
+// Batch groups items into batches of Size items or items received within
+// Every duration since the first item of a batch, whichever comes first.
+// Each batch is passed to the BatchFunc and then written to stdout, so items
+// are passed downstream after the batch was processed. The rest is flushed
+// on io.EOF.
+//
+//	filters.NewBatch(insert).Size(500).Every(2 * time.Second)
+//
+// An error from BatchFunc stops the filter and is returned.
+type Batch[T any] struct {
+	fn    BatchFunc[T]
+	size  int
+	every time.Duration
+	clock pipe.Clock
+}
+
+func NewBatch[T any](fn BatchFunc[T]) Batch[T] {
+	return Batch[T]{fn: fn, clock: pipe.SystemClock()}
+}
+
+// Size flushes a batch when it has n items, zero means no limit
+func (b Batch[T]) Size(n int) Batch[T] {
+	b.size = n
+	return b
+}
+
+// Every flushes a batch d after its first item, zero means no time limit
+func (b Batch[T]) Every(d time.Duration) Batch[T] {
+	b.every = d
+	return b
+}
+
+// Clock sets a clock for Every, default is pipe.SystemClock
+func (b Batch[T]) Clock(clock pipe.Clock) Batch[T] {
+	b.clock = clock
+	return b
+}
+
+// ReadsAsync implements pipe.AsyncReader, stdin is read in a goroutine
+func (b Batch[T]) ReadsAsync() bool {
+	return true
+}
+
+func (b Batch[T]) Name() string {
+	name := "batch"
+	if b.size > 0 {
+		name += fmt.Sprintf(" -n %d", b.size)
+	}
+	if b.every > 0 {
+		name += fmt.Sprintf(" -t %s", b.every)
+	}
+	return name
+}
+
+func (b Batch[T]) Run(ctx context.Context, stdio pipe.StandardIO[T]) error {
+	done := make(chan struct{})
+	defer close(done)
+	reads := readAsync(stdio.Stdin(), done)
+
+	var batch []T
+	var timer pipe.Timer
+	var expired <-chan time.Time
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		out := batch
+		batch = nil
+		if err := b.fn(ctx, out); err != nil {
+			return err
+		}
+		_, err := stdio.Stdout().Write(out)
+		return closedPipe(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			if err := flush(); err != nil {
+				return err
+			}
+		case r := <-reads:
+			for _, item := range r.items {
+				batch = append(batch, item)
+				if b.every > 0 && timer == nil {
+					timer = b.clock.NewTimer(b.every)
+					expired = timer.C()
+				}
+				if b.size > 0 && len(batch) >= b.size {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+			if errors.Is(r.err, io.EOF) {
+				return flush()
+			} else if r.err != nil {
+				return r.err
+			}
+		}
+	}
+}
+
+// BatchBy groups adjacent items with the same key, so a batch is flushed on
+// a key change and on io.EOF. Items are written to stdout after the
+// BatchFunc returns.
+func BatchBy[T any, K comparable](key func(T) K, fn BatchFunc[T]) pipe.Filter[T] {
+	return pipe.Name[T]("batch -k", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		var batch []T
+		var last K
+		var fnErr error
+		flush := func(out []T) []T {
+			if len(batch) == 0 {
+				return out
+			}
+			if fnErr = fn(ctx, batch); fnErr != nil {
+				return out
+			}
+			out = append(out, batch...)
+			batch = nil
+			return out
+		}
+		err := transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			k := key(item)
+			if len(batch) > 0 && k != last {
+				out = flush(out)
+				if fnErr != nil {
+					return out, false
+				}
+			}
+			last = k
+			batch = append(batch, item)
+			return out, true
+		})
+		if err == nil {
+			err = fnErr
+		}
+		if err != nil {
+			return err
+		}
+		out := flush(nil)
+		if fnErr != nil {
+			return fnErr
+		}
+		if len(out) > 0 {
+			_, err = stdio.Stdout().Write(out)
+		}
+		return closedPipe(err)
+	}))
+}
+
+// Window calls the BatchFunc every Slide with all items received within the
+// last Size, a sliding time window. When slide equals size, windows do not
+// overlap and it is a tumbling window. Empty windows and windows without a
+// new item are skipped. Items are passed to stdout as they come.
+type Window[T any] struct {
+	fn    BatchFunc[T]
+	size  time.Duration
+	slide time.Duration
+	clock pipe.Clock
+}
+
+func NewWindow[T any](size, slide time.Duration, fn BatchFunc[T]) Window[T] {
+	if slide <= 0 {
+		slide = size
+	}
+	return Window[T]{fn: fn, size: size, slide: slide, clock: pipe.SystemClock()}
+}
+
+// Clock sets a clock, default is pipe.SystemClock
+func (w Window[T]) Clock(clock pipe.Clock) Window[T] {
+	w.clock = clock
+	return w
+}
+
+// ReadsAsync implements pipe.AsyncReader, stdin is read in a goroutine
+func (w Window[T]) ReadsAsync() bool {
+	return true
+}
+
+func (w Window[T]) Name() string {
+	return fmt.Sprintf("window %s/%s", w.size, w.slide)
+}
+
+type timed[T any] struct {
+	at   time.Time
+	item T
+}
+
+func (w Window[T]) Run(ctx context.Context, stdio pipe.StandardIO[T]) error {
+	done := make(chan struct{})
+	defer close(done)
+	reads := readAsync(stdio.Stdin(), done)
+
+	var items []timed[T]
+	fresh := false
+	emit := func() error {
+		start := w.clock.Now().Add(-w.size)
+		drop := 0
+		for drop < len(items) && !items[drop].at.After(start) {
+			drop++
+		}
+		items = items[drop:]
+		if !fresh || len(items) == 0 {
+			return nil
+		}
+		fresh = false
+		window := make([]T, len(items))
+		for idx, t := range items {
+			window[idx] = t.item
+		}
+		return w.fn(ctx, window)
+	}
+
+	timer := w.clock.NewTimer(w.slide)
+	defer func() { timer.Stop() }()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C():
+			if err := emit(); err != nil {
+				return err
+			}
+			timer = w.clock.NewTimer(w.slide)
+		case r := <-reads:
+			now := w.clock.Now()
+			for _, item := range r.items {
+				items = append(items, timed[T]{at: now, item: item})
+			}
+			if len(r.items) > 0 {
+				fresh = true
+				if _, err := stdio.Stdout().Write(r.items); err != nil {
+					return closedPipe(err)
+				}
+			}
+			if errors.Is(r.err, io.EOF) {
+				return emit()
+			} else if r.err != nil {
+				return r.err
+			}
+		}
+	}
+}
+
+type readResult[T any] struct {
+	items []T
+	err   error
+}
+
+// readAsync reads stdin in a goroutine, so a filter can wait on timers
+// while a read blocks. The goroutine ends on the first error or when done
+// is closed.
+func readAsync[T any](stdin gio.Reader[T], done <-chan struct{}) <-chan readResult[T] {
+	reads := make(chan readResult[T])
+	go func() {
+		for {
+			buf := make([]T, batchSize)
+			n, err := stdin.Read(buf)
+			select {
+			case reads <- readResult[T]{items: buf[:n], err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return reads
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package filters_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio"
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/pipe/filters"
+)
+
+// collect returns a BatchFunc sending batches to a channel
+func collect[T any]() (BatchFunc[T], chan []T) {
+	batches := make(chan []T, 16)
+	return func(_ context.Context, batch []T) error {
+		batches <- batch
+		return nil
+	}, batches
+}
+
+func drain[T any](ch chan []T) [][]T {
+	close(ch)
+	var ret [][]T
+	for batch := range ch {
+		ret = append(ret, batch)
+	}
+	return ret
+}
+
+var epoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestBatchSize(t *testing.T) {
+	t.Parallel()
+	fn, batches := collect[int]()
+	out := run(t, seq(7), pipe.Filter[int](NewBatch(fn).Size(3)))
+	require.Equal(t, seq(7), out)
+	require.Equal(t, [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, drain(batches))
+}
+
+func TestBatchEvery(t *testing.T) {
+	t.Parallel()
+	clock := pipe.NewManualClock(epoch)
+	fn, batches := collect[int]()
+	batch := NewBatch(fn).Size(3).Every(2 * time.Second).Clock(clock)
+	require.Equal(t, "batch -n 3 -t 2s", batch.Name())
+
+	pr, pw := gio.Pipe[int]()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- batch.Run(context.Background(), pipe.NewStdio[int](pr, &sliceWriter[int]{}, os.Stderr))
+	}()
+
+	_, err := pw.Write([]int{1, 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Second)
+	require.Len(t, batches, 0)
+	clock.Advance(time.Second)
+	require.Equal(t, []int{1, 2}, <-batches)
+
+	_, err = pw.Write([]int{3, 4, 5, 6})
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 4, 5}, <-batches)
+	pw.Close()
+	require.NoError(t, <-errc)
+	require.Equal(t, [][]int{{6}}, drain(batches))
+}
+
+func TestBatchError(t *testing.T) {
+	t.Parallel()
+	boom := errors.New("boom")
+	batch := NewBatch(func(context.Context, []int) error { return boom }).Size(2)
+	stdio := pipe.NewStdio[int](&sliceReader[int]{items: seq(5)}, &sliceWriter[int]{}, os.Stderr)
+	require.ErrorIs(t, batch.Run(context.Background(), stdio), boom)
+}
+
+func TestBatchBy(t *testing.T) {
+	t.Parallel()
+	fn, batches := collect[int]()
+	tens := func(x int) int { return x / 10 }
+	out := run(t, []int{1, 2, 11, 12, 13, 21}, BatchBy(tens, fn))
+	require.Equal(t, []int{1, 2, 11, 12, 13, 21}, out)
+	require.Equal(t, [][]int{{1, 2}, {11, 12, 13}, {21}}, drain(batches))
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+	clock := pipe.NewManualClock(epoch)
+	fn, batches := collect[string]()
+	window := NewWindow(3*time.Second, time.Second, fn).Clock(clock)
+	require.Equal(t, "window 3s/1s", window.Name())
+
+	inR, inW := gio.Pipe[string]()
+	outR, outW := gio.Pipe[string]()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- window.Run(context.Background(), pipe.NewStdio[string](inR, outW, os.Stderr))
+		outW.Close()
+	}()
+
+	buf := make([]string, 1)
+	send := func(item string) {
+		t.Helper()
+		_, err := inW.Write([]string{item})
+		require.NoError(t, err)
+		// item is timestamped once it is passed through
+		_, err = outR.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, item, buf[0])
+	}
+	tick := func() {
+		t.Helper()
+		require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+		clock.Advance(time.Second)
+	}
+
+	send("a")
+	tick()
+	require.Equal(t, []string{"a"}, <-batches)
+	send("b")
+	tick()
+	require.Equal(t, []string{"a", "b"}, <-batches)
+	// no new item, window is skipped
+	tick()
+	send("c")
+	tick()
+	require.Equal(t, []string{"c"}, <-batches)
+	send("d")
+	inW.Close()
+	require.NoError(t, <-errc)
+	require.Equal(t, [][]string{{"c", "d"}}, drain(batches))
+}
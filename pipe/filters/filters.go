@@ -0,0 +1,296 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// package filters implements generic filters for pipe.Line like map, head,
+// tail or uniq. All of them read stdin until io.EOF, check the context on
+// each read and are named, so they can be identified in errors.
+//
+// When a downstream filter stops reading, like head does, the write fails
+// with io.ErrClosedPipe. Filters here then stop without an error, as unix
+// tools ignoring SIGPIPE do, so filter | head does not fail with pipefail.
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gomoni/gio"
+	"github.com/gomoni/gio/pipe"
+)
+
+// batchSize is a number of items read from stdin at once
+const batchSize = 64
+
+// transform reads stdin and calls fn for each item. The fn appends items to
+// out which are written to stdout and returns false if it does not want more
+// items.
+func transform[T any](ctx context.Context, stdio pipe.StandardIO[T], fn func(item T, out []T) ([]T, bool)) error {
+	in := make([]T, batchSize)
+	var out []T
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := stdio.Stdin().Read(in)
+		more := true
+		out = out[:0]
+		for _, item := range in[:n] {
+			out, more = fn(item, out)
+			if !more {
+				break
+			}
+		}
+		if len(out) > 0 {
+			if _, werr := stdio.Stdout().Write(out); werr != nil {
+				return closedPipe(werr)
+			}
+		}
+		if !more || errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// consume reads all stdin and writes the result of done to stdout
+func consume[T any](ctx context.Context, stdio pipe.StandardIO[T], fn func(item T), done func() []T) error {
+	err := transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+		fn(item)
+		return out, true
+	})
+	if err != nil {
+		return err
+	}
+	if out := done(); len(out) > 0 {
+		_, err = stdio.Stdout().Write(out)
+	}
+	return closedPipe(err)
+}
+
+// closedPipe returns nil for io.ErrClosedPipe, so filter stops quietly when
+// downstream stops reading
+func closedPipe(err error) error {
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+	return err
+}
+
+// Map writes fn(item) for each item
+func Map[T any](fn func(T) T) pipe.Filter[T] {
+	return pipe.Name[T]("map", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			return append(out, fn(item)), true
+		})
+	}))
+}
+
+// Filter writes only items for which the predicate is true, like grep
+func Filter[T any](predicate func(T) bool) pipe.Filter[T] {
+	return pipe.Name[T]("filter", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			if predicate(item) {
+				out = append(out, item)
+			}
+			return out, true
+		})
+	}))
+}
+
+// FlatMap writes all items returned by fn
+func FlatMap[T any](fn func(T) []T) pipe.Filter[T] {
+	return pipe.Name[T]("flatmap", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			return append(out, fn(item)...), true
+		})
+	}))
+}
+
+// Head writes first n items and stops reading
+func Head[T any](n int) pipe.Filter[T] {
+	return pipe.Name[T](fmt.Sprintf("head -n %d", n), pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		if n <= 0 {
+			return nil
+		}
+		count := 0
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			count++
+			return append(out, item), count < n
+		})
+	}))
+}
+
+// Tail writes last n items
+func Tail[T any](n int) pipe.Filter[T] {
+	return pipe.Name[T](fmt.Sprintf("tail -n %d", n), pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		ring := make([]T, 0, max(n, 0))
+		next := 0
+		return consume(ctx, stdio,
+			func(item T) {
+				if n <= 0 {
+					return
+				}
+				if len(ring) < n {
+					ring = append(ring, item)
+					return
+				}
+				ring[next] = item
+				next = (next + 1) % n
+			},
+			func() []T {
+				return append(ring[next:], ring[:next]...)
+			})
+	}))
+}
+
+// Skip drops first n items and writes the rest, like tail -n +n+1
+func Skip[T any](n int) pipe.Filter[T] {
+	return pipe.Name[T](fmt.Sprintf("skip %d", n), pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		count := 0
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			if count < n {
+				count++
+				return out, true
+			}
+			return append(out, item), true
+		})
+	}))
+}
+
+// TakeWhile writes items while the predicate is true and then stops reading
+func TakeWhile[T any](predicate func(T) bool) pipe.Filter[T] {
+	return pipe.Name[T]("takewhile", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			if !predicate(item) {
+				return out, false
+			}
+			return append(out, item), true
+		})
+	}))
+}
+
+// DropWhile drops items while the predicate is true and then writes the rest
+func DropWhile[T any](predicate func(T) bool) pipe.Filter[T] {
+	return pipe.Name[T]("dropwhile", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		dropping := true
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			if dropping && predicate(item) {
+				return out, true
+			}
+			dropping = false
+			return append(out, item), true
+		})
+	}))
+}
+
+// Uniq drops adjacent items with the same key, like uniq
+func Uniq[T any, K comparable](key func(T) K) pipe.Filter[T] {
+	return pipe.Name[T]("uniq", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		var last K
+		first := true
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			k := key(item)
+			if !first && k == last {
+				return out, true
+			}
+			first = false
+			last = k
+			return append(out, item), true
+		})
+	}))
+}
+
+// UniqCount is like uniq -c. For each group of adjacent items with the same
+// key it writes with(first item of a group, count of items in a group).
+func UniqCount[T any, K comparable](key func(T) K, with func(item T, count int) T) pipe.Filter[T] {
+	return pipe.Name[T]("uniq -c", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		var group T
+		var last K
+		count := 0
+		err := transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			k := key(item)
+			if count > 0 && k == last {
+				count++
+				return out, true
+			}
+			if count > 0 {
+				out = append(out, with(group, count))
+			}
+			group, last, count = item, k, 1
+			return out, true
+		})
+		if err != nil || count == 0 {
+			return err
+		}
+		_, err = stdio.Stdout().Write([]T{with(group, count)})
+		return closedPipe(err)
+	}))
+}
+
+// Distinct drops all items with already seen key. Keys of all distinct
+// items are kept in memory.
+func Distinct[T any, K comparable](key func(T) K) pipe.Filter[T] {
+	return pipe.Name[T]("distinct", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		seen := make(map[K]struct{})
+		return transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+			k := key(item)
+			if _, ok := seen[k]; ok {
+				return out, true
+			}
+			seen[k] = struct{}{}
+			return append(out, item), true
+		})
+	}))
+}
+
+// Reduce folds all items by fn starting with init and writes the result
+func Reduce[T any](init T, fn func(acc T, item T) T) pipe.Filter[T] {
+	return pipe.Name[T]("reduce", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		acc := init
+		return consume(ctx, stdio,
+			func(item T) { acc = fn(acc, item) },
+			func() []T { return []T{acc} })
+	}))
+}
+
+// Count counts items and writes conv(count), like wc -l
+func Count[T any](conv func(count int) T) pipe.Filter[T] {
+	return pipe.Name[T]("count", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		count := 0
+		return consume(ctx, stdio,
+			func(T) { count++ },
+			func() []T { return []T{conv(count)} })
+	}))
+}
+
+// Tee copies items to stdout and to all writers
+func Tee[T any](writers ...gio.Writer[T]) pipe.Filter[T] {
+	return pipe.Name[T]("tee", pipe.FilterFunc[T](func(ctx context.Context, stdio pipe.StandardIO[T]) error {
+		in := make([]T, batchSize)
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := stdio.Stdin().Read(in)
+			if n > 0 {
+				if _, werr := stdio.Stdout().Write(in[:n]); werr != nil {
+					return closedPipe(werr)
+				}
+				for _, w := range writers {
+					if _, werr := w.Write(in[:n]); werr != nil {
+						return werr
+					}
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}))
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package filters_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/pipe/filters"
+)
+
+type sliceReader[T any] struct {
+	items []T
+}
+
+func (r *sliceReader[T]) Read(p []T) (int, error) {
+	if len(r.items) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.items)
+	r.items = r.items[n:]
+	return n, nil
+}
+
+type sliceWriter[T any] struct {
+	items []T
+}
+
+func (w *sliceWriter[T]) Write(p []T) (int, error) {
+	w.items = append(w.items, p...)
+	return len(p), nil
+}
+
+func run[T any](t *testing.T, input []T, filters ...pipe.Filter[T]) []T {
+	t.Helper()
+	out := &sliceWriter[T]{}
+	stdio := pipe.NewStdio[T](&sliceReader[T]{items: input}, out, os.Stderr)
+	err := pipe.NewLine[T]().Run(context.Background(), stdio, filters...)
+	require.NoError(t, err)
+	return out.items
+}
+
+func seq(n int) []int {
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = i + 1
+	}
+	return ret
+}
+
+func identity[T any](x T) T { return x }
+
+func TestFilters(t *testing.T) {
+	t.Parallel()
+	even := func(x int) bool { return x%2 == 0 }
+	small := func(x int) bool { return x < 3 }
+
+	testCases := []struct {
+		name     string
+		input    []int
+		filters  []pipe.Filter[int]
+		expected []int
+	}{
+		{"map", seq(3), []pipe.Filter[int]{Map(func(x int) int { return x * 10 })}, []int{10, 20, 30}},
+		{"filter", seq(5), []pipe.Filter[int]{Filter(even)}, []int{2, 4}},
+		{"flatmap", seq(2), []pipe.Filter[int]{FlatMap(func(x int) []int { return []int{x, x} })}, []int{1, 1, 2, 2}},
+		{"head", seq(200), []pipe.Filter[int]{Head[int](3)}, []int{1, 2, 3}},
+		{"head 0", seq(3), []pipe.Filter[int]{Head[int](0)}, nil},
+		{"tail", seq(200), []pipe.Filter[int]{Tail[int](3)}, []int{198, 199, 200}},
+		{"tail short", seq(2), []pipe.Filter[int]{Tail[int](3)}, []int{1, 2}},
+		{"skip", seq(5), []pipe.Filter[int]{Skip[int](3)}, []int{4, 5}},
+		{"takewhile", seq(5), []pipe.Filter[int]{TakeWhile(small)}, []int{1, 2}},
+		{"dropwhile", []int{1, 2, 3, 1}, []pipe.Filter[int]{DropWhile(small)}, []int{3, 1}},
+		{"uniq", []int{1, 1, 2, 1, 1}, []pipe.Filter[int]{Uniq(identity[int])}, []int{1, 2, 1}},
+		{"uniq -c", []int{1, 1, 2, 1, 1, 1}, []pipe.Filter[int]{UniqCount(identity[int], func(x, count int) int { return x*10 + count })}, []int{12, 21, 13}},
+		{"distinct", []int{1, 1, 2, 1, 3}, []pipe.Filter[int]{Distinct(identity[int])}, []int{1, 2, 3}},
+		{"reduce", seq(4), []pipe.Filter[int]{Reduce(0, func(acc, x int) int { return acc + x })}, []int{10}},
+		{"count", seq(4), []pipe.Filter[int]{Count(identity[int])}, []int{4}},
+		{"count empty", nil, []pipe.Filter[int]{Count(identity[int])}, []int{0}},
+		{"filter | head", seq(100), []pipe.Filter[int]{Filter(even), Head[int](2)}, []int{2, 4}},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, run(t, tt.input, tt.filters...))
+		})
+	}
+}
+
+func TestTee(t *testing.T) {
+	t.Parallel()
+	copy1 := &sliceWriter[int]{}
+	out := run(t, seq(3), Tee[int](copy1))
+	require.Equal(t, seq(3), out)
+	require.Equal(t, seq(3), copy1.items)
+}
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+	require.Equal(t,
+		"head -n 10 | filter | count",
+		pipe.Describe(Head[string](10), Filter(func(string) bool { return true }), Count(strconv.Itoa)),
+	)
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stdio := pipe.NewStdio[int](&sliceReader[int]{items: seq(3)}, &sliceWriter[int]{}, os.Stderr)
+	err := Map(identity[int]).Run(ctx, stdio)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,349 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package filters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gomoni/gio"
+	"github.com/gomoni/gio/pipe"
+)
+
+// SortError is a code returned for sort failures, as GNU sort does
+const SortError = 2
+
+// Sort is an external merge sort filter, an equivalent of sort. Items are
+// sorted in memory, unless Spill is used. Then at most n items are kept in
+// memory, full buffers are sorted and written to temporary files via a codec
+// and all runs are merged in the end. At most BatchSize runs are merged at
+// once, more runs are merged in several passes, so the number of open files
+// stays bounded.
+//
+// The cmp returns a negative number when a < b, a positive number when a > b
+// and zero otherwise, as in slices.SortFunc.
+//
+// Temporary files are removed when Run returns, including a cancel. Errors
+// are returned as pipe.Error with code SortError.
+type Sort[T any] struct {
+	cmp    func(a, b T) int
+	codec  gio.Codec[T]
+	buffer int
+	batch  int
+	stable bool
+	unique bool
+	dir    string
+}
+
+// defaultBatchSize is the number of runs merged at once, as GNU sort does
+const defaultBatchSize = 16
+
+func NewSort[T any](cmp func(a, b T) int) Sort[T] {
+	return Sort[T]{cmp: cmp, batch: defaultBatchSize}
+}
+
+// Stable keeps equal items in an input order, like sort -s
+func (s Sort[T]) Stable(b bool) Sort[T] {
+	s.stable = b
+	return s
+}
+
+// Unique writes only the first of equal items, like sort -u
+func (s Sort[T]) Unique(b bool) Sort[T] {
+	s.unique = b
+	return s
+}
+
+// Spill keeps at most n items in memory, the rest is spilled to temporary
+// files encoded by a codec
+func (s Sort[T]) Spill(codec gio.Codec[T], n int) Sort[T] {
+	s.codec = codec
+	s.buffer = max(n, 1)
+	return s
+}
+
+// BatchSize merges at most n spilled runs at once, like sort --batch-size.
+// The minimum is 2, default is 16.
+func (s Sort[T]) BatchSize(n int) Sort[T] {
+	s.batch = max(n, 2)
+	return s
+}
+
+// TempDir sets a directory for temporary files, like sort -T. Default is
+// os.TempDir.
+func (s Sort[T]) TempDir(dir string) Sort[T] {
+	s.dir = dir
+	return s
+}
+
+func (s Sort[T]) Name() string {
+	name := "sort"
+	if s.stable {
+		name += " -s"
+	}
+	if s.unique {
+		name += " -u"
+	}
+	return name
+}
+
+func (s Sort[T]) Run(ctx context.Context, stdio pipe.StandardIO[T]) error {
+	var buf []T
+	var runs []string
+	var dir string
+	defer func() {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	var spillErr error
+	err := transform(ctx, stdio, func(item T, out []T) ([]T, bool) {
+		buf = append(buf, item)
+		if s.codec == nil || len(buf) < s.buffer {
+			return out, true
+		}
+		if dir == "" {
+			if dir, spillErr = os.MkdirTemp(s.dir, "gio-sort-"); spillErr != nil {
+				return out, false
+			}
+		}
+		s.sort(buf)
+		run := filepath.Join(dir, fmt.Sprintf("run-%d", len(runs)))
+		if spillErr = s.spill(run, buf); spillErr != nil {
+			return out, false
+		}
+		runs = append(runs, run)
+		clear(buf)
+		buf = buf[:0]
+		return out, true
+	})
+	if err == nil {
+		err = spillErr
+	}
+	if err != nil {
+		return s.error(err)
+	}
+
+	// the in memory buffer is merged with runs in the end, so it counts to
+	// the batch size too
+	for pass := 0; len(runs) >= s.batchSize(); pass++ {
+		if runs, err = s.mergePass(ctx, dir, pass, runs); err != nil {
+			return s.error(err)
+		}
+	}
+
+	s.sort(buf)
+	var in gio.Reader[T] = &sliceReader[T]{items: buf}
+	if len(runs) > 0 {
+		readers, closeAll, err := s.open(runs)
+		defer closeAll()
+		if err != nil {
+			return s.error(err)
+		}
+		// in memory buffer contains the last items, so it goes last to
+		// keep the merge stable
+		in = pipe.MergeSorted(s.cmp, append(readers, in)...)
+	}
+
+	err = s.write(ctx, stdio, in)
+	return s.error(closedPipe(err))
+}
+
+func (s Sort[T]) sort(items []T) {
+	if s.stable {
+		slices.SortStableFunc(items, s.cmp)
+	} else {
+		slices.SortFunc(items, s.cmp)
+	}
+}
+
+func (s Sort[T]) batchSize() int {
+	if s.batch < 2 {
+		return defaultBatchSize
+	}
+	return s.batch
+}
+
+// mergePass merges consecutive groups of at most batch size runs into new
+// runs. Groups keep the order of runs, so the merge stays stable.
+func (s Sort[T]) mergePass(ctx context.Context, dir string, pass int, runs []string) ([]string, error) {
+	batch := s.batchSize()
+	merged := make([]string, 0, (len(runs)+batch-1)/batch)
+	for start := 0; start < len(runs); start += batch {
+		group := runs[start:min(start+batch, len(runs))]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
+		run := filepath.Join(dir, fmt.Sprintf("pass-%d-%d", pass, len(merged)))
+		if err := s.merge(ctx, run, group); err != nil {
+			return nil, err
+		}
+		merged = append(merged, run)
+	}
+	return merged, nil
+}
+
+// merge merges runs into a new file and removes them
+func (s Sort[T]) merge(ctx context.Context, path string, runs []string) error {
+	readers, closeAll, err := s.open(runs)
+	defer closeAll()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := s.codec.NewEncoder(w)
+	in := pipe.MergeSorted(s.cmp, readers...)
+	buf := make([]T, batchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, rerr := in.Read(buf)
+		for _, item := range buf[:n] {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		if errors.Is(rerr, io.EOF) {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	closeAll()
+	for _, run := range runs {
+		if err := os.Remove(run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open opens runs for reading, the returned function closes all opened files
+// and is safe to call more than once
+func (s Sort[T]) open(runs []string) ([]gio.Reader[T], func(), error) {
+	files := make([]*os.File, 0, len(runs))
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+		files = files[:0]
+	}
+	readers := make([]gio.Reader[T], 0, len(runs)+1)
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return nil, closeAll, err
+		}
+		files = append(files, f)
+		readers = append(readers, decodeReader[T]{dec: s.codec.NewDecoder(bufio.NewReader(f))})
+	}
+	return readers, closeAll, nil
+}
+
+// spill writes sorted items to a file
+func (s Sort[T]) spill(path string, items []T) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := s.codec.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// write copies sorted items to stdout, dropping duplicates if unique
+func (s Sort[T]) write(ctx context.Context, stdio pipe.StandardIO[T], in gio.Reader[T]) error {
+	buf := make([]T, batchSize)
+	var last T
+	first := true
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := in.Read(buf)
+		out := buf[:0]
+		for _, item := range buf[:n] {
+			if s.unique && !first && s.cmp(last, item) == 0 {
+				continue
+			}
+			first = false
+			last = item
+			out = append(out, item)
+		}
+		if len(out) > 0 {
+			if _, werr := stdio.Stdout().Write(out); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (s Sort[T]) error(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return pipe.NewErrorf(SortError, "sort: %w", err)
+}
+
+type sliceReader[T any] struct {
+	items []T
+}
+
+func (r *sliceReader[T]) Read(p []T) (int, error) {
+	if len(r.items) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.items)
+	r.items = r.items[n:]
+	return n, nil
+}
+
+// decodeReader reads items from a gio.Decoder
+type decodeReader[T any] struct {
+	dec gio.Decoder[T]
+}
+
+func (r decodeReader[T]) Read(p []T) (int, error) {
+	for idx := range p {
+		if err := r.dec.Decode(&p[idx]); err != nil {
+			return idx, err
+		}
+	}
+	return len(p), nil
+}
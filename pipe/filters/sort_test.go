@@ -0,0 +1,164 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package filters_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio"
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/pipe/filters"
+)
+
+type keyed struct {
+	Key   int
+	Value int
+}
+
+func byKey(a, b keyed) int {
+	return cmp.Compare(a.Key, b.Key)
+}
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+	input := []int{5, 3, 9, 1, 3, 7, 1, 8, 2, 5}
+
+	testCases := []struct {
+		name     string
+		sort     Sort[int]
+		expected []int
+	}{
+		{"memory", NewSort(cmp.Compare[int]), []int{1, 1, 2, 3, 3, 5, 5, 7, 8, 9}},
+		{"memory unique", NewSort(cmp.Compare[int]).Unique(true), []int{1, 2, 3, 5, 7, 8, 9}},
+		{"spill", NewSort(cmp.Compare[int]).Spill(gio.GobCodec[int]{}, 3), []int{1, 1, 2, 3, 3, 5, 5, 7, 8, 9}},
+		{"spill unique", NewSort(cmp.Compare[int]).Spill(gio.JSONCodec[int]{}, 2).Unique(true), []int{1, 2, 3, 5, 7, 8, 9}},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			out := run(t, input, pipe.Filter[int](tt.sort.TempDir(dir)))
+			require.Equal(t, tt.expected, out)
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestSortStable(t *testing.T) {
+	t.Parallel()
+	var input []keyed
+	for i := 0; i < 100; i++ {
+		input = append(input, keyed{Key: i % 3, Value: i})
+	}
+	sort := NewSort(byKey).Stable(true).Spill(gio.GobCodec[keyed]{}, 7).TempDir(t.TempDir())
+	out := run(t, input, pipe.Filter[keyed](sort))
+	require.Len(t, out, len(input))
+	for i := 1; i < len(out); i++ {
+		prev, cur := out[i-1], out[i]
+		require.True(t, prev.Key < cur.Key || (prev.Key == cur.Key && prev.Value < cur.Value), "%+v before %+v", prev, cur)
+	}
+}
+
+// openCodec counts decoders which did not reach the end yet
+type openCodec struct {
+	gio.GobCodec[keyed]
+	open    *int
+	maxOpen *int
+}
+
+func (c openCodec) NewDecoder(r io.Reader) gio.Decoder[keyed] {
+	*c.open++
+	*c.maxOpen = max(*c.maxOpen, *c.open)
+	return openDecoder{dec: c.GobCodec.NewDecoder(r), open: c.open}
+}
+
+type openDecoder struct {
+	dec  gio.Decoder[keyed]
+	open *int
+}
+
+func (d openDecoder) Decode(item *keyed) error {
+	err := d.dec.Decode(item)
+	if errors.Is(err, io.EOF) {
+		*d.open--
+	}
+	return err
+}
+
+func TestSortBatchSize(t *testing.T) {
+	t.Parallel()
+	var input []keyed
+	for i := 0; i < 100; i++ {
+		input = append(input, keyed{Key: i % 7, Value: i})
+	}
+	var open, maxOpen int
+	codec := openCodec{open: &open, maxOpen: &maxOpen}
+	dir := t.TempDir()
+	// 33 runs merged by 3 need several passes
+	sort := NewSort(byKey).Stable(true).Spill(codec, 3).BatchSize(3).TempDir(dir)
+	out := run(t, input, pipe.Filter[keyed](sort))
+	require.Len(t, out, len(input))
+	for i := 1; i < len(out); i++ {
+		prev, cur := out[i-1], out[i]
+		require.True(t, prev.Key < cur.Key || (prev.Key == cur.Key && prev.Value < cur.Value), "%+v before %+v", prev, cur)
+	}
+	require.Equal(t, 3, maxOpen)
+	require.Zero(t, open)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+type failCodec struct{}
+
+func (failCodec) NewEncoder(io.Writer) gio.Encoder[int] { return failCodec{} }
+func (failCodec) NewDecoder(io.Reader) gio.Decoder[int] { return nil }
+func (failCodec) Encode(int) error                      { return errors.New("encode failed") }
+
+func TestSortError(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	stdio := pipe.NewStdio[int](&sliceReader[int]{items: seq(10)}, &sliceWriter[int]{}, os.Stderr)
+	err := NewSort(cmp.Compare[int]).Spill(failCodec{}, 2).TempDir(dir).Run(context.Background(), stdio)
+	var perr pipe.Error
+	require.ErrorAs(t, err, &perr)
+	require.Equal(t, SortError, perr.Code)
+	require.EqualError(t, err, "Error{Code: 2, Err: sort: encode failed}")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSortCancel(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := gio.Pipe[int]()
+	go func() {
+		pw.Write(seq(10))
+		cancel()
+		pw.Write(seq(10))
+	}()
+	stdio := pipe.NewStdio[int](pr, &sliceWriter[int]{}, os.Stderr)
+	err := NewSort(cmp.Compare[int]).Spill(gio.GobCodec[int]{}, 2).TempDir(dir).Run(ctx, stdio)
+	require.ErrorIs(t, err, context.Canceled)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,406 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gomoni/gio"
+)
+
+// Node is a filter added to a Graph
+type Node int
+
+// Fanout defines how items are sent to more downstream nodes
+type Fanout int
+
+const (
+	// Broadcast sends every item to all downstream nodes, like tee
+	Broadcast Fanout = iota
+	// RoundRobin sends each item to a next downstream node
+	RoundRobin
+)
+
+// Fanin defines how items from more upstream nodes are merged
+type Fanin int
+
+const (
+	// Interleave reads all upstream nodes concurrently and items are passed as
+	// they come
+	Interleave Fanin = iota
+	// Concat reads upstream nodes one after another in order they were
+	// connected, like cat a b. Upstream nodes must not share an upstream
+	// node or stdin, as it would block on a node not yet read. Run rejects
+	// such graphs.
+	Concat
+)
+
+// Graph connects filters to a directed acyclic graph. An output of a node
+// can go to more downstream nodes and more upstream nodes can be merged to
+// a single one. Nodes without an upstream read from stdin, nodes without a
+// downstream write to stdout.
+//
+//	g := pipe.NewGraph[Record]()
+//	src := g.Add(source)
+//	g.Connect(src, g.Add(archive), g.Add(aggregate))
+//	err := g.Run(ctx, stdio)
+//
+// The error handling is the same as in Line, where the last node is the last
+// one added.
+type Graph[T any] struct {
+	line  Line[T]
+	nodes []graphNode[T]
+}
+
+type graphNode[T any] struct {
+	filter Filter[T]
+	fanout Fanout
+	fanin  Fanin
+	ins    []Node
+	outs   []Node
+}
+
+func NewGraph[T any]() *Graph[T] {
+	return &Graph[T]{line: NewLine[T]()}
+}
+
+// Pipefail has the same meaning as Line.Pipefail
+func (g *Graph[T]) Pipefail(b bool) *Graph[T] {
+	g.line = g.line.Pipefail(b)
+	return g
+}
+
+// Observe adds observers, see Line.Observe. Stage index is the Node.
+func (g *Graph[T]) Observe(observers ...Observer) *Graph[T] {
+	g.line = g.line.Observe(observers...)
+	return g
+}
+
+// DeadLetter sets a sink for rejected items, see Line.DeadLetter
+func (g *Graph[T]) DeadLetter(sink gio.Writer[DeadLetter[T]]) *Graph[T] {
+	g.line = g.line.DeadLetter(sink)
+	return g
+}
+
+// MaxRejects sets a limit of rejected items, see Line.MaxRejects
+func (g *Graph[T]) MaxRejects(n int) *Graph[T] {
+	g.line = g.line.MaxRejects(n)
+	return g
+}
+
+// Add adds a filter to the graph
+func (g *Graph[T]) Add(filter Filter[T]) Node {
+	g.nodes = append(g.nodes, graphNode[T]{filter: filter})
+	return Node(len(g.nodes) - 1)
+}
+
+// Connect sends an output of from to all nodes in to
+func (g *Graph[T]) Connect(from Node, to ...Node) *Graph[T] {
+	for _, n := range to {
+		g.nodes[from].outs = append(g.nodes[from].outs, n)
+		g.nodes[n].ins = append(g.nodes[n].ins, from)
+	}
+	return g
+}
+
+// Fanout sets how node sends items to more downstream nodes. The default is
+// Broadcast.
+func (g *Graph[T]) Fanout(node Node, mode Fanout) *Graph[T] {
+	g.nodes[node].fanout = mode
+	return g
+}
+
+// Fanin sets how node reads items from more upstream nodes. The default is
+// Interleave.
+func (g *Graph[T]) Fanin(node Node, mode Fanin) *Graph[T] {
+	g.nodes[node].fanin = mode
+	return g
+}
+
+// String renders the graph, one edge per line
+func (g *Graph[T]) String() string {
+	var ret string
+	for idx, node := range g.nodes {
+		for _, out := range node.outs {
+			ret += fmt.Sprintf("%d:%s -> %d:%s\n", idx, FilterName(node.filter), out, FilterName(g.nodes[out].filter))
+		}
+	}
+	return ret
+}
+
+var errCycle = errors.New("pipe: graph contains a cycle")
+
+// validate checks the graph does not contain cycles and Concat nodes do not
+// read from a common upstream. Roots share stdin if it is not nil.
+func (g *Graph[T]) validate(stdin bool) error {
+	if len(g.nodes) == 0 {
+		return errors.New("pipe: graph is empty")
+	}
+	indegree := make([]int, len(g.nodes))
+	for _, node := range g.nodes {
+		for _, out := range node.outs {
+			indegree[out]++
+		}
+	}
+	var queue []Node
+	for idx, d := range indegree {
+		if d == 0 {
+			queue = append(queue, Node(idx))
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, out := range g.nodes[n].outs {
+			indegree[out]--
+			if indegree[out] == 0 {
+				queue = append(queue, out)
+			}
+		}
+	}
+	if visited != len(g.nodes) {
+		return errCycle
+	}
+	return g.validateConcat(stdin)
+}
+
+// stdinNode is a virtual upstream of all roots reading a shared stdin
+const stdinNode Node = -1
+
+// validateConcat rejects Concat nodes with inputs sharing an upstream node.
+// The upstream blocks on writing to an input which is not read yet, so a
+// Concat node never reads more than its first input.
+func (g *Graph[T]) validateConcat(stdin bool) error {
+	roots := 0
+	for _, node := range g.nodes {
+		if len(node.ins) == 0 {
+			roots++
+		}
+	}
+	stdin = stdin && roots > 1
+
+	upstreams := make(map[Node]map[Node]bool)
+	var upstream func(n Node) map[Node]bool
+	upstream = func(n Node) map[Node]bool {
+		if ret, ok := upstreams[n]; ok {
+			return ret
+		}
+		ret := map[Node]bool{n: true}
+		if stdin && len(g.nodes[n].ins) == 0 {
+			ret[stdinNode] = true
+		}
+		for _, in := range g.nodes[n].ins {
+			for u := range upstream(in) {
+				ret[u] = true
+			}
+		}
+		upstreams[n] = ret
+		return ret
+	}
+
+	for idx, node := range g.nodes {
+		if node.fanin != Concat || len(node.ins) < 2 {
+			continue
+		}
+		for u := stdinNode; int(u) < len(g.nodes); u++ {
+			shared := 0
+			for _, in := range node.ins {
+				if upstream(in)[u] {
+					shared++
+				}
+			}
+			if shared > 1 {
+				return g.concatError(Node(idx), u)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Graph[T]) concatError(concat, common Node) error {
+	name := FilterName(g.nodes[concat].filter)
+	if common == stdinNode {
+		return fmt.Errorf("pipe: graph: concat node %d:%s reads from a shared stdin", concat, name)
+	}
+	return fmt.Errorf("pipe: graph: concat node %d:%s reads from a common upstream node %d:%s", concat, name, common, FilterName(g.nodes[common].filter))
+}
+
+// Run connects all nodes via gio.Pipe with a stdio and runs each in own
+// goroutine.
+func (g *Graph[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	if err := g.validate(stdio.Stdin() != nil); err != nil {
+		return NewError(1, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rejects := g.line.newRejects()
+
+	type edge struct{ from, to Node }
+	readers := make(map[edge]gio.ReadCloser[T])
+	writers := make(map[edge]gio.WriteCloser[T])
+	for idx, node := range g.nodes {
+		for _, out := range node.outs {
+			pr, pw := gio.Pipe[T]()
+			e := edge{from: Node(idx), to: out}
+			readers[e] = pr
+			writers[e] = pw
+		}
+	}
+
+	var roots, sinks []Node
+	for idx, node := range g.nodes {
+		if len(node.ins) == 0 {
+			roots = append(roots, Node(idx))
+		}
+		if len(node.outs) == 0 {
+			sinks = append(sinks, Node(idx))
+		}
+	}
+
+	stdins := make(map[Node]gio.ReadCloser[T])
+	// closed once the copy of stdin to roots ends
+	copied := make(chan struct{})
+	if len(roots) == 1 {
+		stdins[roots[0]] = nopCloseR[T]{r: stdio.Stdin()}
+	} else if stdio.Stdin() != nil {
+		// all roots get a copy of stdin
+		pws := make([]*gio.PipeWriter[T], len(roots))
+		ws := make([]gio.WriteCloser[T], len(roots))
+		for idx, root := range roots {
+			pr, pw := gio.Pipe[T]()
+			stdins[root] = pr
+			pws[idx] = pw
+			ws[idx] = pw
+		}
+		go func() {
+			defer close(copied)
+			err := copyAll[T](&fanoutWriter[T]{writers: ws}, stdio.Stdin())
+			for _, pw := range pws {
+				pw.CloseWithError(err)
+			}
+		}()
+	} else {
+		for _, root := range roots {
+			stdins[root] = nopCloseR[T]{r: &sliceReader[T]{}}
+		}
+	}
+	if len(roots) == 1 || stdio.Stdin() == nil {
+		close(copied)
+	}
+
+	var stdout gio.Writer[T] = stdio.Stdout()
+	if len(sinks) > 1 {
+		stdout = &lockedWriter[T]{w: stdout}
+	}
+
+	errs := errorSlice{errs: make([]error, len(g.nodes))}
+	var hasError atomic.Bool
+	var wg sync.WaitGroup
+	for idx, node := range g.nodes {
+		n := Node(idx)
+		var in gio.ReadCloser[T]
+		switch len(node.ins) {
+		case 0:
+			in = stdins[n]
+		case 1:
+			in = readers[edge{from: node.ins[0], to: n}]
+		default:
+			ins := make([]gio.ReadCloser[T], len(node.ins))
+			for i, from := range node.ins {
+				ins[i] = readers[edge{from: from, to: n}]
+			}
+			if node.fanin == Concat {
+				in = &concatReader[T]{readers: ins}
+			} else {
+				in = newMergeReader[T](ins...)
+			}
+		}
+
+		var out gio.WriteCloser[T]
+		switch len(node.outs) {
+		case 0:
+			out = nopCloseW[T]{w: stdout}
+		case 1:
+			out = writers[edge{from: n, to: node.outs[0]}]
+		default:
+			outs := make([]gio.WriteCloser[T], len(node.outs))
+			for i, to := range node.outs {
+				outs[i] = writers[edge{from: n, to: to}]
+			}
+			out = &fanoutWriter[T]{writers: outs, roundRobin: node.fanout == RoundRobin}
+		}
+
+		wg.Add(1)
+		stage := Stage{Index: idx, Name: FilterName(node.filter)}
+		go g.line.runOne(
+			ctx,
+			cancel,
+			&errs,
+			&hasError,
+			stage,
+			&wg,
+			node.filter,
+			gostdio[T]{stdin: in, stdout: out, stderr: stdio.Stderr(), rejecter: rejects.forStage(stage, stdio), extra: streamsOf(stdio), env: EnvironOf(stdio)})
+	}
+
+	wg.Wait()
+	// roots closed their stdin, so the copy ends on the next write
+	<-copied
+
+	if g.line.noPipeFail {
+		return errs.noPipefail(1)
+	}
+	return errs.pipefail(1)
+}
+
+// fanoutWriter writes to all writers or to the next one
+type fanoutWriter[T any] struct {
+	writers    []gio.WriteCloser[T]
+	roundRobin bool
+	next       int
+}
+
+func (f *fanoutWriter[T]) Write(data []T) (int, error) {
+	if !f.roundRobin {
+		for _, w := range f.writers {
+			if _, err := w.Write(data); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+	for idx := range data {
+		if _, err := f.writers[f.next].Write(data[idx : idx+1]); err != nil {
+			return idx, err
+		}
+		f.next = (f.next + 1) % len(f.writers)
+	}
+	return len(data), nil
+}
+
+func (f *fanoutWriter[T]) Close() error {
+	for _, w := range f.writers {
+		w.Close()
+	}
+	return nil
+}
+
+// lockedWriter serializes writes from more goroutines
+type lockedWriter[T any] struct {
+	mu sync.Mutex
+	w  gio.Writer[T]
+}
+
+func (l *lockedWriter[T]) Write(data []T) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(data)
+}
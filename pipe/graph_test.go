@@ -0,0 +1,212 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+// Prefix adds a prefix to each line
+type Prefix struct {
+	prefix string
+}
+
+func (p Prefix) Run(ctx context.Context, stdio StandardIO[string]) error {
+	buf := make([]string, 1)
+	for {
+		_, err := stdio.Stdin().Read(buf)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := stdio.Stdout().Write([]string{p.prefix + buf[0]}); err != nil {
+			return err
+		}
+	}
+}
+
+type Collect struct {
+	lines *[]string
+}
+
+func (c Collect) Run(ctx context.Context, stdio StandardIO[string]) error {
+	buf := make([]string, 1)
+	for {
+		_, err := stdio.Stdin().Read(buf)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		*c.lines = append(*c.lines, buf[0])
+	}
+}
+
+func TestGraph(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pigs := []string{"three", "small", "pigs"}
+
+	t.Run("broadcast", func(t *testing.T) {
+		t.Parallel()
+		var archive []string
+		g := NewGraph[string]()
+		src := g.Add(Lines{cat: pigs})
+		g.Connect(src, g.Add(Collect{lines: &archive}), g.Add(CountLines{}))
+
+		out := &StringBuffer{}
+		err := g.Run(ctx, NewStdio[string](nil, out, os.Stderr))
+		require.NoError(t, err)
+		require.Equal(t, pigs, archive)
+		require.Equal(t, "3", out.String())
+		require.Equal(t, "0:Lines -> 1:Collect\n0:Lines -> 2:CountLines\n", g.String())
+	})
+
+	t.Run("round robin and interleave", func(t *testing.T) {
+		t.Parallel()
+		var lines []string
+		g := NewGraph[string]()
+		src := g.Add(Lines{cat: pigs})
+		a := g.Add(Prefix{prefix: "a:"})
+		b := g.Add(Prefix{prefix: "b:"})
+		sink := g.Add(Collect{lines: &lines})
+		g.Connect(src, a, b).Fanout(src, RoundRobin)
+		g.Connect(a, sink)
+		g.Connect(b, sink)
+
+		err := g.Run(ctx, NewStdio[string](nil, &StringBuffer{}, os.Stderr))
+		require.NoError(t, err)
+		sort.Strings(lines)
+		require.Equal(t, []string{"a:pigs", "a:three", "b:small"}, lines)
+	})
+
+	t.Run("concat", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		a := g.Add(Lines{cat: []string{"a", "b"}})
+		b := g.Add(Lines{cat: []string{"c", "d"}})
+		cat := g.Add(Prefix{})
+		g.Connect(b, cat)
+		g.Connect(a, cat)
+		g.Fanin(cat, Concat)
+
+		out := &StringBuffer{}
+		err := g.Run(ctx, NewStdio[string](nil, out, os.Stderr))
+		require.NoError(t, err)
+		require.Equal(t, "cdab", out.String())
+	})
+
+	t.Run("concat from a common upstream", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		src := g.Add(Lines{cat: pigs})
+		a := g.Add(Prefix{prefix: "a:"})
+		b := g.Add(Prefix{prefix: "b:"})
+		cat := g.Add(Prefix{})
+		g.Connect(src, a, b)
+		g.Connect(a, cat)
+		g.Connect(b, cat)
+		g.Fanin(cat, Concat)
+
+		err := g.Run(ctx, NewStdio[string](nil, &StringBuffer{}, os.Stderr))
+		require.EqualError(t, err, "Error{Code: 1, Err: pipe: graph: concat node 3:Prefix reads from a common upstream node 0:Lines}")
+
+		// roots share stdin
+		g = NewGraph[string]()
+		a = g.Add(Prefix{prefix: "a:"})
+		b = g.Add(Prefix{prefix: "b:"})
+		cat = g.Add(Prefix{})
+		g.Connect(a, cat)
+		g.Connect(b, cat)
+		g.Fanin(cat, Concat)
+
+		err = g.Run(ctx, NewStdio[string](&StringReader{lines: []string{"x"}}, &StringBuffer{}, os.Stderr))
+		require.EqualError(t, err, "Error{Code: 1, Err: pipe: graph: concat node 2:Prefix reads from a shared stdin}")
+	})
+
+	t.Run("stdin to more roots", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		g.Add(Prefix{prefix: "a:"})
+		g.Add(Prefix{prefix: "b:"})
+
+		out := &StringBuffer{}
+		err := g.Run(ctx, NewStdio[string](&StringReader{lines: []string{"x"}}, out, os.Stderr))
+		require.NoError(t, err)
+		require.Contains(t, []string{"a:xb:x", "b:xa:x"}, out.String())
+	})
+
+	t.Run("pipefail", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		src := g.Add(Name[string]("false", Fail{err: io.EOF}))
+		g.Connect(src, g.Add(CountLines{}), g.Add(CountLines{}))
+
+		err := g.Run(ctx, NewStdio[string](nil, &StringBuffer{}, os.Stderr))
+		require.EqualError(t, err, "Error{Code: 1, Err: false: EOF}")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		a := g.Add(Prefix{})
+		b := g.Add(Prefix{})
+		g.Connect(a, b)
+		g.Connect(b, a)
+		err := g.Run(ctx, NewStdio[string](nil, &StringBuffer{}, os.Stderr))
+		require.EqualError(t, err, "Error{Code: 1, Err: pipe: graph contains a cycle}")
+	})
+
+	t.Run("stdin copy stops", func(t *testing.T) {
+		t.Parallel()
+		g := NewGraph[string]()
+		g.Add(Fail{err: io.EOF})
+		g.Add(Fail{err: io.EOF})
+
+		in := &slowReader{}
+		err := g.Run(ctx, NewStdio[string](in, &StringBuffer{}, os.Stderr))
+		require.Error(t, err)
+		require.False(t, in.reading.Load())
+	})
+}
+
+// StringReader reads lines from a slice
+type StringReader struct {
+	lines []string
+}
+
+func (r *StringReader) Read(p []string) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lines)
+	r.lines = r.lines[n:]
+	return n, nil
+}
+
+// slowReader returns a line each 10ms forever
+type slowReader struct {
+	reading atomic.Bool
+}
+
+func (r *slowReader) Read(p []string) (int, error) {
+	r.reading.Store(true)
+	defer r.reading.Store(false)
+	time.Sleep(10 * time.Millisecond)
+	p[0] = "x"
+	return 1, nil
+}
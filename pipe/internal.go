@@ -6,6 +6,7 @@ package pipe
 
 import (
 	"errors"
+	"io"
 
 	"github.com/gomoni/gio"
 )
@@ -34,6 +35,30 @@ func (nopCloseW[T]) Close() error {
 	return nil
 }
 
+// sliceReader reads items from a slice and then returns io.EOF
+type sliceReader[T any] struct {
+	items []T
+}
+
+func (r *sliceReader[T]) Read(data []T) (int, error) {
+	if len(r.items) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(data, r.items)
+	r.items = r.items[n:]
+	return n, nil
+}
+
+// sliceWriter appends all written items to a slice
+type sliceWriter[T any] struct {
+	items []T
+}
+
+func (w *sliceWriter[T]) Write(data []T) (int, error) {
+	w.items = append(w.items, data...)
+	return len(data), nil
+}
+
 type errorSlice struct {
 	errs []error
 }
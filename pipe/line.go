@@ -10,8 +10,10 @@ package pipe
 import (
 	"context"
 	"io"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gomoni/gio"
 )
@@ -20,10 +22,23 @@ import (
 // by connecting the filters via gio.Pipe
 type Line[T any] struct {
 	noPipeFail bool
+	observer   Observer
+	deadLetter gio.Writer[DeadLetter[T]]
+	maxRejects int
+	store      CheckpointStore
+	every      time.Duration
+	spools     []spoolSpec[T]
+}
+
+type spoolSpec[T any] struct {
+	after int
+	limit int
+	codec gio.Codec[T]
+	dir   string
 }
 
 func NewLine[T any]() Line[T] {
-	return Line[T]{}
+	return Line[T]{maxRejects: -1}
 }
 
 // Pipefail - true (the default) is an equivalent of set -o pipefail, so pipe is canceled
@@ -35,9 +50,69 @@ func (p Line[T]) Pipefail(b bool) Line[T] {
 	return p
 }
 
+// Observe adds observers called on each stage start and end, on each Read and
+// Write and on close or cancel. See Observer and Event for details.
+func (p Line[T]) Observe(observers ...Observer) Line[T] {
+	var all multiObserver
+	switch o := p.observer.(type) {
+	case nil:
+	case multiObserver:
+		all = append(all, o...)
+	default:
+		all = append(all, o)
+	}
+	p.observer = append(all, observers...)
+	return p
+}
+
+// DeadLetter sets a sink for items rejected by filters via Reject. Rejected
+// items go to the sink while the processing continues. Sink is called from
+// all stages, but never concurrently. Without a sink, rejected items go to
+// a sink of a parent Line if there is one.
+func (p Line[T]) DeadLetter(sink gio.Writer[DeadLetter[T]]) Line[T] {
+	p.deadLetter = sink
+	return p
+}
+
+// MaxRejects fails a stage which rejects more than n items in total with
+// ErrTooManyRejects. Negative value (the default) means no limit.
+func (p Line[T]) MaxRejects(n int) Line[T] {
+	p.maxRejects = n
+	return p
+}
+
+// Checkpoint enables checkpoints. Run restores Snapshotter stages from the
+// last checkpoint in store, then it saves a new checkpoint every duration
+// and clears the store when the line succeeds. Every must be positive or
+// CheckpointEveryWrite, which saves a checkpoint after each Write of the
+// first stage.
+//
+// A checkpoint is consistent, it holds states of all stages after the same
+// item of the first stage. Items written to stdout after the checkpoint
+// are written again after a restart. A checkpoint completes only if all
+// stages read until the end, so a stage which stops reading early, like
+// head, disables checkpoints. Stages reading asynchronously, see AsyncReader,
+// are rejected.
+func (p Line[T]) Checkpoint(store CheckpointStore, every time.Duration) Line[T] {
+	p.store = store
+	p.every = every
+	return p
+}
+
+// Spool connects a stage after with the next one via gio.SpoolPipe instead
+// of gio.Pipe, so the stage is not blocked by a slow downstream. Up to limit
+// items are kept in memory, the rest is encoded by codec to a file in dir.
+// It can't be combined with Checkpoint.
+func (p Line[T]) Spool(after int, limit int, codec gio.Codec[T], dir string) Line[T] {
+	p.spools = append(slices.Clip(p.spools), spoolSpec[T]{after: after, limit: limit, codec: codec, dir: dir})
+	return p
+}
+
 // Run joins all filters via gio.Pipe with a stdio. Each filter runs in own goroutine and function
 // returns on all. The returned error depends on Pipefail value
 //
+// Errors of Named filters are wrapped by StageError, so the failed stage can be identified.
+//
 // true (the default) - returns nil if none of commands fail, otherwise returns
 // all errors in a pipe in a slice. If the first failure is Error, then it's
 // Code is returned. otherwise code 1 is used.
@@ -46,11 +121,41 @@ func (p Line[T]) Pipefail(b bool) Line[T] {
 // the call is nil. for non nil errors, it returns a slice of all errors and a
 // code or 1 depending on a type of last error.
 func (p Line[T]) Run(ctx context.Context, stdio StandardIO[T], filters ...Filter[T]) error {
+	if p.observer != nil {
+		stop := context.AfterFunc(ctx, func() {
+			p.observer.Observe(Event{Kind: EventCancel, Stage: Stage{Index: -1}, Time: time.Now(), Err: context.Cause(ctx)})
+		})
+		defer stop()
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if p.store != nil && len(p.spools) > 0 {
+		return NewErrorf(1, "pipe: spool can't be combined with checkpoint")
+	}
+	var cp *checkpointer[T]
+	if p.store != nil {
+		cp = newCheckpointer(p.store, p.every, filters)
+		if err := cp.validate(); err != nil {
+			return NewError(1, err)
+		}
+		if err := cp.restore(); err != nil {
+			return NewError(1, err)
+		}
+		cp.start()
+		defer cp.close()
+	}
+
+	rejects := p.newRejects()
 	if len(filters) == 1 {
-		return filters[0].Run(ctx, stdio)
+		err := p.runSingle(ctx, stdio, filters[0], rejects, cp)
+		if err == nil && cp != nil {
+			if cerr := p.store.Clear(); cerr != nil {
+				return NewError(1, cerr)
+			}
+		}
+		return err
 	}
 
 	errs := errorSlice{errs: make([]error, len(filters))}
@@ -61,8 +166,14 @@ func (p Line[T]) Run(ctx context.Context, stdio StandardIO[T], filters ...Filter
 		var nextIn gio.ReadCloser[T]
 		var out gio.WriteCloser[T]
 		isLast := idx == len(filters)-1
-		if isLast {
+		if cp != nil {
+			out, nextIn = cp.connect(idx, in, isLast, stdio.Stdout())
+		} else if isLast {
 			out = nopCloseW[T]{w: stdio.Stdout()}
+		} else if spool, ok := p.spool(idx); ok {
+			spoolR, spoolW := gio.SpoolPipe[T](spool.limit, spool.codec, spool.dir)
+			out = spoolW
+			nextIn = spoolR
 		} else {
 			pipeR, pipeW := gio.Pipe[T]()
 			out = pipeW
@@ -70,15 +181,16 @@ func (p Line[T]) Run(ctx context.Context, stdio StandardIO[T], filters ...Filter
 		}
 
 		wg.Add(1)
+		stage := Stage{Index: idx, Name: FilterName(filter)}
 		go p.runOne(
 			ctx,
 			cancel,
 			&errs,
 			&hasError,
-			idx,
+			stage,
 			&wg,
 			filter,
-			gostdio[T]{stdin: in, stdout: out, stderr: stdio.Stderr()})
+			gostdio[T]{stdin: in, stdout: out, stderr: stdio.Stderr(), rejecter: rejects.forStage(stage, stdio), extra: streamsOf(stdio), env: EnvironOf(stdio)})
 		in = nextIn
 	}
 
@@ -86,21 +198,35 @@ func (p Line[T]) Run(ctx context.Context, stdio StandardIO[T], filters ...Filter
 
 	// XXX: improve error handling
 	//      wait on 1.20 errors with Join and Unwrap []error
+	var err error
 	if p.noPipeFail {
-		return errs.noPipefail(1)
+		err = errs.noPipefail(1)
 	} else {
-		return errs.pipefail(1)
+		err = errs.pipefail(1)
+	}
+	if err == nil && cp != nil {
+		if cerr := p.store.Clear(); cerr != nil {
+			return NewError(1, cerr)
+		}
 	}
+	return err
 }
 
 type gostdio[T any] struct {
-	stdin  gio.ReadCloser[T]
-	stdout gio.WriteCloser[T]
-	stderr io.Writer
+	stdin    gio.ReadCloser[T]
+	stdout   gio.WriteCloser[T]
+	stderr   io.Writer
+	rejecter rejecter[T]
+	extra    streams
+	env      Environ
 }
 
-func (p Line[T]) runOne(ctx context.Context, cancel context.CancelFunc, errs *errorSlice, hasError *atomic.Bool, idx int, wg *sync.WaitGroup, filter Filter[T], stdio gostdio[T]) {
+func (p Line[T]) runOne(ctx context.Context, cancel context.CancelFunc, errs *errorSlice, hasError *atomic.Bool, stage Stage, wg *sync.WaitGroup, filter Filter[T], stdio gostdio[T]) {
 	defer wg.Done()
+	if p.observer != nil {
+		stdio.stdin = observedR[T]{r: stdio.stdin, o: p.observer, stage: stage}
+		stdio.stdout = observedW[T]{w: stdio.stdout, o: p.observer, stage: stage}
+	}
 	defer stdio.stdin.Close()
 	defer stdio.stdout.Close()
 
@@ -109,12 +235,73 @@ func (p Line[T]) runOne(ctx context.Context, cancel context.CancelFunc, errs *er
 		return
 	}
 
-	err := filter.Run(ctx, Stdio[T]{stdin: stdio.stdin, stdout: stdio.stdout, stderr: stdio.stderr})
-	errs.set(idx, err)
+	p.observe(Event{Kind: EventStart, Stage: stage})
+	err := filter.Run(ctx, Stdio[T]{stdin: stdio.stdin, stdout: stdio.stdout, stderr: stdio.stderr, rejecter: stdio.rejecter, extra: stdio.extra, env: stdio.env})
+	err = stageError(filter, err)
+	errs.set(stage.Index, err)
+	p.observe(Event{Kind: EventEnd, Stage: stage, Err: err})
 	if err != nil {
-		hasError.Store(true)
+		first := !hasError.Swap(true)
 		if !p.noPipeFail {
+			if first {
+				p.observe(Event{Kind: EventCancel, Stage: stage, Err: err})
+			}
 			cancel()
 		}
 	}
 }
+
+// runSingle runs one filter without pipes, so its error is returned as is.
+// Observers, dead letters and checkpoints work like for more filters.
+func (p Line[T]) runSingle(ctx context.Context, stdio StandardIO[T], filter Filter[T], rejects *rejects[T], cp *checkpointer[T]) error {
+	stage := Stage{Index: 0, Name: FilterName(filter)}
+	if p.observer == nil && rejects == nil && cp == nil {
+		return stageError(filter, filter.Run(ctx, stdio))
+	}
+
+	var in gio.ReadCloser[T] = nopCloseR[T]{r: stdio.Stdin()}
+	var out gio.WriteCloser[T] = nopCloseW[T]{w: stdio.Stdout()}
+	if cp != nil {
+		out, _ = cp.connect(0, in, true, stdio.Stdout())
+	}
+	if p.observer != nil {
+		in = observedR[T]{r: in, o: p.observer, stage: stage}
+		out = observedW[T]{w: out, o: p.observer, stage: stage}
+	}
+	defer in.Close()
+	defer out.Close()
+
+	p.observe(Event{Kind: EventStart, Stage: stage})
+	err := filter.Run(ctx, Stdio[T]{stdin: in, stdout: out, stderr: stdio.Stderr(), rejecter: rejects.forStage(stage, stdio), extra: streamsOf(stdio), env: EnvironOf(stdio)})
+	err = stageError(filter, err)
+	p.observe(Event{Kind: EventEnd, Stage: stage, Err: err})
+	if err != nil && !p.noPipeFail {
+		p.observe(Event{Kind: EventCancel, Stage: stage, Err: err})
+	}
+	return err
+}
+
+func (p Line[T]) spool(idx int) (spoolSpec[T], bool) {
+	for _, s := range p.spools {
+		if s.after == idx {
+			return s, true
+		}
+	}
+	return spoolSpec[T]{}, false
+}
+
+// newRejects returns a dead letter state for one Run or nil if a sink is not set
+func (p Line[T]) newRejects() *rejects[T] {
+	if p.deadLetter == nil {
+		return nil
+	}
+	return &rejects[T]{sink: p.deadLetter, max: p.maxRejects, observe: p.observe}
+}
+
+func (p Line[T]) observe(e Event) {
+	if p.observer == nil {
+		return
+	}
+	e.Time = time.Now()
+	p.observer.Observe(e)
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/gomoni/gio"
+)
+
+// Merge reads from all readers concurrently and returns items as they come.
+// The first error other than io.EOF is returned after all readers are done.
+// Close stops the merge and closes readers which are gio.ReadCloser.
+func Merge[T any](readers ...gio.Reader[T]) gio.ReadCloser[T] {
+	rcs := make([]gio.ReadCloser[T], len(readers))
+	for idx, r := range readers {
+		if rc, ok := r.(gio.ReadCloser[T]); ok {
+			rcs[idx] = rc
+		} else {
+			rcs[idx] = nopCloseR[T]{r: r}
+		}
+	}
+	return newMergeReader[T](rcs...)
+}
+
+type mergeReader[T any] struct {
+	pr      *gio.PipeReader[T]
+	readers []gio.ReadCloser[T]
+}
+
+func newMergeReader[T any](readers ...gio.ReadCloser[T]) *mergeReader[T] {
+	pr, pw := gio.Pipe[T]()
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r gio.Reader[T]) {
+			defer wg.Done()
+			if err := copyAll[T](pw, r); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		pw.CloseWithError(firstErr)
+	}()
+	return &mergeReader[T]{pr: pr, readers: readers}
+}
+
+func (m *mergeReader[T]) Read(data []T) (int, error) {
+	return m.pr.Read(data)
+}
+
+func (m *mergeReader[T]) Close() error {
+	m.pr.Close()
+	for _, r := range m.readers {
+		r.Close()
+	}
+	return nil
+}
+
+// MergeRoundRobin reads one item from each reader in turn. Readers at io.EOF
+// are skipped. Each Read returns at most one item per reader.
+func MergeRoundRobin[T any](readers ...gio.Reader[T]) gio.Reader[T] {
+	return &roundRobinReader[T]{readers: append([]gio.Reader[T](nil), readers...)}
+}
+
+type roundRobinReader[T any] struct {
+	readers []gio.Reader[T]
+	next    int
+}
+
+func (r *roundRobinReader[T]) Read(data []T) (int, error) {
+	n := 0
+	for rounds := len(r.readers); rounds > 0 && n < len(data) && len(r.readers) > 0; rounds-- {
+		got, err := r.readers[r.next].Read(data[n : n+1])
+		n += got
+		if errors.Is(err, io.EOF) {
+			r.readers = append(r.readers[:r.next], r.readers[r.next+1:]...)
+			if r.next >= len(r.readers) {
+				r.next = 0
+			}
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		r.next = (r.next + 1) % len(r.readers)
+	}
+	if n == 0 && len(r.readers) == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// MergeSorted merges readers with items sorted by cmp into one sorted stream,
+// an equivalent of sort -m. The cmp returns a negative number when a < b, a
+// positive number when a > b and zero otherwise, as in slices.SortFunc.
+// Equal items are returned in an order of readers, so the merge is stable.
+func MergeSorted[T any](cmp func(a, b T) int, readers ...gio.Reader[T]) gio.Reader[T] {
+	return &sortedReader[T]{
+		cmp:     cmp,
+		readers: readers,
+		heads:   make([]T, len(readers)),
+		state:   make([]headState, len(readers)),
+	}
+}
+
+type headState int
+
+const (
+	headEmpty headState = iota
+	headFull
+	headEOF
+)
+
+type sortedReader[T any] struct {
+	cmp     func(a, b T) int
+	readers []gio.Reader[T]
+	heads   []T
+	state   []headState
+}
+
+func (s *sortedReader[T]) Read(data []T) (int, error) {
+	n := 0
+	for n < len(data) {
+		if err := s.fill(); err != nil {
+			return n, err
+		}
+		next := -1
+		for idx, state := range s.state {
+			if state != headFull {
+				continue
+			}
+			if next == -1 || s.cmp(s.heads[idx], s.heads[next]) < 0 {
+				next = idx
+			}
+		}
+		if next == -1 {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+		data[n] = s.heads[next]
+		n++
+		var zero T
+		s.heads[next] = zero
+		s.state[next] = headEmpty
+	}
+	return n, nil
+}
+
+// fill reads a head item from all readers not at io.EOF
+func (s *sortedReader[T]) fill() error {
+	for idx, state := range s.state {
+		for state == headEmpty {
+			got, err := s.readers[idx].Read(s.heads[idx : idx+1])
+			if got == 1 {
+				state = headFull
+			} else if errors.Is(err, io.EOF) {
+				state = headEOF
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+		}
+		s.state[idx] = state
+	}
+	return nil
+}
+
+// Pair is an item produced by Zip
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip reads one item from a and one from b and returns them as a Pair, like
+// paste does for lines. It stops on the end of the shorter reader.
+func Zip[A, B any](a gio.Reader[A], b gio.Reader[B]) gio.Reader[Pair[A, B]] {
+	return &zipReader[A, B]{a: a, b: b}
+}
+
+type zipReader[A, B any] struct {
+	a   gio.Reader[A]
+	b   gio.Reader[B]
+	err error
+}
+
+func (z *zipReader[A, B]) Read(data []Pair[A, B]) (int, error) {
+	n := 0
+	for ; n < len(data) && z.err == nil; n++ {
+		var a [1]A
+		var b [1]B
+		if z.err = readOne[A](z.a, a[:]); z.err != nil {
+			break
+		}
+		if z.err = readOne[B](z.b, b[:]); z.err != nil {
+			break
+		}
+		data[n] = Pair[A, B]{First: a[0], Second: b[0]}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, z.err
+}
+
+// readOne reads exactly one item, io.EOF is returned only if nothing was read
+func readOne[T any](r gio.Reader[T], buf []T) error {
+	for {
+		n, err := r.Read(buf)
+		if n == 1 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// concatReader reads readers one after another
+type concatReader[T any] struct {
+	readers []gio.ReadCloser[T]
+	idx     int
+}
+
+func (c *concatReader[T]) Read(data []T) (int, error) {
+	for c.idx < len(c.readers) {
+		n, err := c.readers[c.idx].Read(data)
+		if errors.Is(err, io.EOF) {
+			c.idx++
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (c *concatReader[T]) Close() error {
+	for _, r := range c.readers {
+		r.Close()
+	}
+	return nil
+}
+
+// copyAll copies all items from r to w until io.EOF
+func copyAll[T any](w gio.Writer[T], r gio.Reader[T]) error {
+	buf := make([]T, 512)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
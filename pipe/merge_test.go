@@ -0,0 +1,88 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio"
+	. "github.com/gomoni/gio/pipe"
+)
+
+func readAll[T any](t *testing.T, r gio.Reader[T]) []T {
+	t.Helper()
+	var ret []T
+	buf := make([]T, 4)
+	for {
+		n, err := r.Read(buf)
+		ret = append(ret, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			return ret
+		}
+		require.NoError(t, err)
+	}
+}
+
+func lines(s ...string) gio.Reader[string] {
+	return &StringReader{lines: s}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	got := readAll(t, Merge(lines("a", "c"), lines("b"), lines()))
+	sort.Strings(got)
+	require.Equal(t, []string{"a", "b", "c"}, got)
+
+	merge := Merge(lines("a"))
+	require.NoError(t, merge.Close())
+	_, err := merge.Read(make([]string, 1))
+	require.Error(t, err)
+}
+
+func TestMergeRoundRobin(t *testing.T) {
+	t.Parallel()
+	got := readAll(t, MergeRoundRobin(lines("a1", "a2", "a3"), lines("b1"), lines("c1", "c2")))
+	require.Equal(t, []string{"a1", "b1", "c1", "a2", "c2", "a3"}, got)
+}
+
+func TestMergeSorted(t *testing.T) {
+	t.Parallel()
+	type item struct {
+		key    int
+		source string
+	}
+	a := &sliceReader[item]{items: []item{{1, "a"}, {3, "a"}, {5, "a"}}}
+	b := &sliceReader[item]{items: []item{{2, "b"}, {3, "b"}}}
+	c := &sliceReader[item]{}
+	byKey := func(x, y item) int { return cmp.Compare(x.key, y.key) }
+	got := readAll[item](t, MergeSorted[item](byKey, a, b, c))
+	require.Equal(t, []item{{1, "a"}, {2, "b"}, {3, "a"}, {3, "b"}, {5, "a"}}, got)
+}
+
+func TestZip(t *testing.T) {
+	t.Parallel()
+	nums := &sliceReader[int]{items: []int{1, 2, 3}}
+	got := readAll(t, Zip[string, int](lines("one", "two"), nums))
+	require.Equal(t, []Pair[string, int]{{"one", 1}, {"two", 2}}, got)
+}
+
+type sliceReader[T any] struct {
+	items []T
+}
+
+func (r *sliceReader[T]) Read(p []T) (int, error) {
+	if len(r.items) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.items)
+	r.items = r.items[n:]
+	return n, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StageMetrics are counters of a one stage of a pipeline.
+//
+//	ReadBlocked - time spent waiting on an upstream
+//	WriteBlocked - time spent waiting on a downstream
+//	ReadRate and WriteRate - items per second since a stage start
+type StageMetrics struct {
+	Stage
+	Running      bool
+	Started      time.Time
+	Ended        time.Time
+	Reads        int64
+	Writes       int64
+	ItemsRead    int64
+	ItemsWritten int64
+	Rejected     int64
+	ReadBlocked  time.Duration
+	WriteBlocked time.Duration
+	ReadRate     float64
+	WriteRate    float64
+}
+
+// Elapsed returns how long the stage runs or did run
+func (m StageMetrics) Elapsed(now time.Time) time.Duration {
+	if m.Started.IsZero() {
+		return 0
+	}
+	if !m.Ended.IsZero() {
+		now = m.Ended
+	}
+	return now.Sub(m.Started)
+}
+
+// Metrics is an Observer collecting per stage metrics. Snapshot can be
+// called while a line is running.
+//
+//	metrics := pipe.NewMetrics()
+//	go func() {
+//		for range time.Tick(time.Second) {
+//			metrics.WritePrometheus(os.Stderr)
+//		}
+//	}()
+//	err := pipe.NewLine[string]().Observe(metrics).Run(ctx, stdio, filters...)
+type Metrics struct {
+	mu     sync.Mutex
+	stages map[int]*StageMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{stages: make(map[int]*StageMetrics)}
+}
+
+func (m *Metrics) Observe(e Event) {
+	if e.Stage.Index < 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.stages[e.Stage.Index]
+	if !ok {
+		s = &StageMetrics{Stage: e.Stage}
+		m.stages[e.Stage.Index] = s
+	}
+	switch e.Kind {
+	case EventStart:
+		s.Running = true
+		s.Started = e.Time
+	case EventEnd:
+		s.Running = false
+		s.Ended = e.Time
+	case EventRead:
+		s.Reads++
+		s.ItemsRead += int64(e.N)
+		s.ReadBlocked += e.Blocked
+	case EventWrite:
+		s.Writes++
+		s.ItemsWritten += int64(e.N)
+		s.WriteBlocked += e.Blocked
+	case EventReject:
+		s.Rejected += int64(e.N)
+	}
+}
+
+// Snapshot returns a copy of metrics of all stages ordered by a stage index
+func (m *Metrics) Snapshot() []StageMetrics {
+	now := time.Now()
+	m.mu.Lock()
+	ret := make([]StageMetrics, 0, len(m.stages))
+	for _, s := range m.stages {
+		ret = append(ret, *s)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Index < ret[j].Index })
+	for idx := range ret {
+		if elapsed := ret[idx].Elapsed(now).Seconds(); elapsed > 0 {
+			ret[idx].ReadRate = float64(ret[idx].ItemsRead) / elapsed
+			ret[idx].WriteRate = float64(ret[idx].ItemsWritten) / elapsed
+		}
+	}
+	return ret
+}
+
+type promMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(StageMetrics) float64
+}
+
+var promMetrics = []promMetric{
+	{"gio_stage_running", "gauge", "Whether a stage is running.", func(s StageMetrics) float64 {
+		if s.Running {
+			return 1
+		}
+		return 0
+	}},
+	{"gio_stage_items_read_total", "counter", "Items read by a stage.", func(s StageMetrics) float64 { return float64(s.ItemsRead) }},
+	{"gio_stage_items_written_total", "counter", "Items written by a stage.", func(s StageMetrics) float64 { return float64(s.ItemsWritten) }},
+	{"gio_stage_rejected_total", "counter", "Items rejected by a stage.", func(s StageMetrics) float64 { return float64(s.Rejected) }},
+	{"gio_stage_read_blocked_seconds_total", "counter", "Time a stage was blocked on upstream.", func(s StageMetrics) float64 { return s.ReadBlocked.Seconds() }},
+	{"gio_stage_write_blocked_seconds_total", "counter", "Time a stage was blocked on downstream.", func(s StageMetrics) float64 { return s.WriteBlocked.Seconds() }},
+	{"gio_stage_read_items_per_second", "gauge", "Items read per second.", func(s StageMetrics) float64 { return s.ReadRate }},
+	{"gio_stage_written_items_per_second", "gauge", "Items written per second.", func(s StageMetrics) float64 { return s.WriteRate }},
+}
+
+// WritePrometheus writes a Snapshot in a Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	stages := m.Snapshot()
+	bw := bufio.NewWriter(w)
+	for _, metric := range promMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", metric.name, metric.typ)
+		for _, s := range stages {
+			fmt.Fprintf(bw, "%s{stage=\"%d\",name=\"%s\"} %s\n",
+				metric.name,
+				s.Index,
+				promEscape(s.Name),
+				strconv.FormatFloat(metric.value(s), 'g', -1, 64),
+			)
+		}
+	}
+	return bw.Flush()
+}
+
+var promReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promEscape(s string) string {
+	return promReplacer.Replace(s)
+}
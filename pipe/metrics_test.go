@@ -0,0 +1,47 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cat := Name[string]("cat", Lines{cat: []string{"three", "small", "pigs"}})
+	wc := Name[string](`wc "-l"`, CountLines{})
+
+	stdio := NewStdio[string](nil, &StringBuffer{}, os.Stderr)
+
+	metrics := NewMetrics()
+	err := NewLine[string]().Observe(metrics).Run(ctx, stdio, cat, wc)
+	require.NoError(t, err)
+
+	snapshot := metrics.Snapshot()
+	require.Len(t, snapshot, 2)
+	require.Equal(t, Stage{Index: 0, Name: "cat"}, snapshot[0].Stage)
+	require.False(t, snapshot[0].Running)
+	require.EqualValues(t, 0, snapshot[0].ItemsRead)
+	require.EqualValues(t, 3, snapshot[0].ItemsWritten)
+	require.EqualValues(t, 3, snapshot[1].ItemsRead)
+	require.EqualValues(t, 1, snapshot[1].ItemsWritten)
+	require.False(t, snapshot[1].Ended.Before(snapshot[1].Started))
+
+	var out strings.Builder
+	err = metrics.WritePrometheus(&out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "# TYPE gio_stage_items_read_total counter\n")
+	require.Contains(t, out.String(), `gio_stage_items_written_total{stage="0",name="cat"} 3`+"\n")
+	require.Contains(t, out.String(), `gio_stage_items_read_total{stage="1",name="wc \"-l\""} 3`+"\n")
+	require.Contains(t, out.String(), `gio_stage_running{stage="1",name="wc \"-l\""} 0`+"\n")
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Named is an optional interface of a Filter. The name is used in errors
+// returned by Line and in a pipeline description.
+type Named interface {
+	Name() string
+}
+
+// Name gives a filter a name, so the stage can be identified in errors and
+// descriptions
+//
+//	pipe.Name("grep foo", grep)
+func Name[T any](name string, filter Filter[T]) Filter[T] {
+	return named[T]{name: name, filter: filter}
+}
+
+type named[T any] struct {
+	name   string
+	filter Filter[T]
+}
+
+func (n named[T]) Name() string {
+	return n.name
+}
+
+func (n named[T]) Unwrap() any {
+	return n.filter
+}
+
+func (n named[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	return n.filter.Run(ctx, stdio)
+}
+
+// FilterName returns a name of a Named filter. A filter wrapping other one
+// can provide Unwrap() any method, so the name of wrapped filter is used
+// instead. Otherwise it returns a name of a Go type.
+func FilterName(filter any) string {
+	if n, ok := filter.(Named); ok {
+		if name := n.Name(); name != "" {
+			return name
+		}
+	}
+	if w, ok := filter.(interface{ Unwrap() any }); ok {
+		return FilterName(w.Unwrap())
+	}
+	name, _, _ := strings.Cut(fmt.Sprintf("%T", filter), "[")
+	if idx := strings.LastIndexByte(name, '.'); idx != -1 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// Describe renders the filters like a shell does, so cat | grep foo | wc -l
+func Describe[T any](filters ...Filter[T]) string {
+	names := make([]string, len(filters))
+	for idx, filter := range filters {
+		names[idx] = FilterName(filter)
+	}
+	return strings.Join(names, " | ")
+}
+
+// StageError annotates an error returned by a Named filter with its name
+type StageError struct {
+	Name string
+	Err  error
+}
+
+func (e StageError) Error() string {
+	return fmt.Sprintf("%s: %+v", e.Name, e.Err)
+}
+
+func (e StageError) Unwrap() error {
+	return e.Err
+}
+
+// stageError wraps err by StageError if filter is Named. For Error only its
+// Err is wrapped.
+func stageError(filter any, err error) error {
+	if err == nil {
+		return nil
+	}
+	n, ok := filter.(Named)
+	if !ok || n.Name() == "" {
+		return err
+	}
+	// Error stays outer, so callers can get its Code as before
+	if pipeErr, ok := err.(Error); ok {
+		pipeErr.Err = StageError{Name: n.Name(), Err: pipeErr.Err}
+		return pipeErr
+	}
+	return StageError{Name: n.Name(), Err: err}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+	cat := Name[string]("cat", Lines{})
+	wc := Name[string]("wc -l", CountLines{})
+
+	require.Equal(t, "cat | wc -l", Describe(cat, wc))
+	require.Equal(t, "cat | Fail | wc -l", Describe[string](cat, Fail{}, wc))
+	require.Equal(t, "Lines", FilterName(Name[string]("", Lines{})))
+	require.Equal(t, "", Describe[string]())
+}
+
+func TestNamedError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cat := Name[string]("cat", Lines{cat: []string{"three", "small", "pigs"}})
+	fail := Name[string]("false", Fail{err: io.EOF})
+	wc := Name[string]("wc -l", CountLines{})
+
+	out := &StringBuffer{}
+	stdio := NewStdio[string](nil, out, os.Stderr)
+
+	err := NewLine[string]().Run(ctx, stdio, fail, cat, wc)
+	pipeErr, ok := err.(Error)
+	require.True(t, ok)
+	require.Equal(t, 1, pipeErr.Code)
+	// other stages may fail on the cancel too, so only the first one is checked
+	require.EqualError(t, Errors(err)[0], "false: EOF")
+
+	var stageErr StageError
+	require.True(t, errors.As(Errors(err)[0], &stageErr))
+	require.Equal(t, "false", stageErr.Name)
+
+	err = NewLine[string]().Run(ctx, stdio, fail)
+	require.EqualError(t, err, "false: EOF")
+
+	// Error stays outer, so its Code is kept
+	exit := Name[string]("exit 3", Fail{err: NewError(3, io.EOF)})
+	err = NewLine[string]().Run(ctx, stdio, exit)
+	pipeErr, ok = err.(Error)
+	require.True(t, ok)
+	require.Equal(t, 3, pipeErr.Code)
+	require.True(t, errors.As(pipeErr.Err, &stageErr))
+	require.Equal(t, "exit 3", stageErr.Name)
+
+	err = NewLine[string]().Run(ctx, stdio, exit, wc)
+	pipeErr, ok = err.(Error)
+	require.True(t, ok)
+	require.Equal(t, 3, pipeErr.Code)
+	require.Len(t, Errors(err), 2)
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gomoni/gio"
+)
+
+// EventKind identifies what happened in a pipeline
+type EventKind int
+
+const (
+	// EventStart is sent before a filter starts
+	EventStart EventKind = iota
+	// EventEnd is sent after a filter returns, Err is the returned error
+	EventEnd
+	// EventRead is sent after each Read from a stage stdin
+	EventRead
+	// EventWrite is sent after each Write to a stage stdout
+	EventWrite
+	// EventClose is sent when a stage stdout is closed
+	EventClose
+	// EventCancel is sent when a pipeline is canceled. This happens on a
+	// first failure with a pipefail, or when a parent context is done. The
+	// later has a Stage.Index -1.
+	EventCancel
+	// EventReject is sent when a stage rejects an item via Reject, Err is
+	// the reason
+	EventReject
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStart:
+		return "start"
+	case EventEnd:
+		return "end"
+	case EventRead:
+		return "read"
+	case EventWrite:
+		return "write"
+	case EventClose:
+		return "close"
+	case EventCancel:
+		return "cancel"
+	case EventReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// Stage identifies a filter in a pipeline. Name is a FilterName.
+type Stage struct {
+	Index int
+	Name  string
+}
+
+// Event describes what happened in a pipeline stage.
+//
+//	N - number of items read or written
+//	Blocked - how long the Read or Write call took
+//	Err - error returned by the filter, Read, Write or a cancel cause
+type Event struct {
+	Kind    EventKind
+	Stage   Stage
+	Time    time.Time
+	N       int
+	Blocked time.Duration
+	Err     error
+}
+
+// Observer is called by Line for each Event. It is called from goroutines
+// of all stages, so it must be safe for a concurrent use. As it is called
+// on each Read and Write it should be fast too.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is an adapter to use ordinary function as an Observer
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Observe(e Event) {
+	for _, o := range m {
+		o.Observe(e)
+	}
+}
+
+// LogObserver writes events via log/slog. Read and Write are logged on a
+// debug level, rejected items on a warn level, failures on an error level
+// and the rest on an info level.
+type LogObserver struct {
+	Logger *slog.Logger
+}
+
+// NewLogObserver logs all events in a text format to stderr
+func NewLogObserver(stderr io.Writer) LogObserver {
+	handler := slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return LogObserver{Logger: slog.New(handler)}
+}
+
+func (o LogObserver) Observe(e Event) {
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.Int("stage", e.Stage.Index),
+		slog.String("name", e.Stage.Name),
+	}
+	switch e.Kind {
+	case EventRead, EventWrite:
+		level = slog.LevelDebug
+		attrs = append(attrs, slog.Int("n", e.N), slog.Duration("blocked", e.Blocked))
+	case EventEnd:
+		if e.Err != nil {
+			level = slog.LevelError
+		}
+	case EventReject:
+		level = slog.LevelWarn
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("err", e.Err))
+	}
+	o.Logger.LogAttrs(context.Background(), level, e.Kind.String(), attrs...)
+}
+
+// Recorder is an in memory Observer intended for tests
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *Recorder) Observe(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns a copy of all recorded events. If kinds are given, only
+// events of those kinds are returned.
+func (r *Recorder) Events(kinds ...EventKind) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make([]Event, 0, len(r.events))
+	for _, e := range r.events {
+		if len(kinds) > 0 && !slices.Contains(kinds, e.Kind) {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// Reset drops all recorded events
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+type observedR[T any] struct {
+	r     gio.ReadCloser[T]
+	o     Observer
+	stage Stage
+}
+
+func (r observedR[T]) Read(data []T) (int, error) {
+	start := time.Now()
+	n, err := r.r.Read(data)
+	r.o.Observe(Event{Kind: EventRead, Stage: r.stage, Time: start, N: n, Blocked: time.Since(start), Err: err})
+	return n, err
+}
+
+func (r observedR[T]) Close() error {
+	return r.r.Close()
+}
+
+type observedW[T any] struct {
+	w     gio.WriteCloser[T]
+	o     Observer
+	stage Stage
+}
+
+func (w observedW[T]) Write(data []T) (int, error) {
+	start := time.Now()
+	n, err := w.w.Write(data)
+	w.o.Observe(Event{Kind: EventWrite, Stage: w.stage, Time: start, N: n, Blocked: time.Since(start), Err: err})
+	return n, err
+}
+
+func (w observedW[T]) Close() error {
+	err := w.w.Close()
+	w.o.Observe(Event{Kind: EventClose, Stage: w.stage, Time: time.Now(), Err: err})
+	return err
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cat := Name[string]("cat", Lines{cat: []string{"three", "small", "pigs"}})
+	wc := Name[string]("wc -l", CountLines{})
+
+	out := &StringBuffer{}
+	stdio := NewStdio[string](nil, out, os.Stderr)
+
+	recorder := &Recorder{}
+	err := NewLine[string]().Observe(recorder).Run(ctx, stdio, cat, wc)
+	require.NoError(t, err)
+	require.Equal(t, "3", out.String())
+
+	starts := recorder.Events(EventStart)
+	require.Len(t, starts, 2)
+	ends := recorder.Events(EventEnd)
+	require.Len(t, ends, 2)
+	for _, e := range ends {
+		require.NoError(t, e.Err)
+	}
+
+	written := map[string]int{}
+	for _, e := range recorder.Events(EventWrite) {
+		written[e.Stage.Name] += e.N
+	}
+	require.Equal(t, map[string]int{"cat": 3, "wc -l": 1}, written)
+
+	read := 0
+	for _, e := range recorder.Events(EventRead) {
+		require.Equal(t, Stage{Index: 1, Name: "wc -l"}, e.Stage)
+		read += e.N
+	}
+	require.Equal(t, 3, read)
+	require.Len(t, recorder.Events(EventClose), 2)
+	require.Empty(t, recorder.Events(EventCancel))
+}
+
+func TestRecorderCancel(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fail := Name[string]("false", Fail{err: io.EOF})
+	wc := Name[string]("wc -l", CountLines{})
+
+	stdio := NewStdio[string](nil, &StringBuffer{}, os.Stderr)
+
+	recorder := &Recorder{}
+	err := NewLine[string]().Observe(recorder).Run(ctx, stdio, fail, wc)
+	require.Error(t, err)
+
+	cancels := recorder.Events(EventCancel)
+	require.Len(t, cancels, 1)
+	require.Equal(t, Stage{Index: 0, Name: "false"}, cancels[0].Stage)
+	require.ErrorIs(t, cancels[0].Err, io.EOF)
+}
+
+func TestRecorderSingle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fail := Name[string]("false", Fail{err: NewError(3, io.EOF)})
+	stdio := NewStdio[string](nil, &StringBuffer{}, os.Stderr)
+
+	expected := NewLine[string]().Run(ctx, stdio, fail)
+	recorder := &Recorder{}
+	err := NewLine[string]().Observe(recorder).Run(ctx, stdio, fail)
+	require.Equal(t, expected, err)
+	err = NewLine[string]().DeadLetter(DeadLetterFunc[string](func(DeadLetter[string]) error { return nil })).Run(ctx, stdio, fail)
+	require.Equal(t, expected, err)
+
+	require.Len(t, recorder.Events(EventStart), 1)
+	ends := recorder.Events(EventEnd)
+	require.Len(t, ends, 1)
+	require.Equal(t, expected, ends[0].Err)
+	require.Len(t, recorder.Events(EventCancel), 1)
+}
+
+func TestLogObserver(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cat := Name[string]("cat", Lines{cat: []string{"three", "small", "pigs"}})
+
+	var log bytes.Buffer
+	stdio := NewStdio[string](nil, &StringBuffer{}, os.Stderr)
+	err := NewLine[string]().Observe(NewLogObserver(&log)).Run(ctx, stdio, cat)
+	require.NoError(t, err)
+	require.Contains(t, log.String(), "level=INFO msg=start stage=0 name=cat")
+	require.Contains(t, log.String(), "level=DEBUG msg=write stage=0 name=cat n=1")
+	require.Contains(t, log.String(), "level=INFO msg=end stage=0 name=cat")
+}
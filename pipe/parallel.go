@@ -0,0 +1,183 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/gomoni/gio"
+)
+
+// Parallel runs a filter for each input item in n goroutines, an equivalent
+// of xargs -P n -n 1. Each Run of the filter gets exactly one item on its
+// stdin and whatever it writes to stdout is passed downstream.
+//
+// Ordered (the default) keeps the order of input items, results which are
+// ready sooner are held in a reorder buffer. Unordered mode writes results as
+// soon as they're ready.
+//
+// The first error cancels all running workers and is returned.
+type Parallel[T any] struct {
+	n         int
+	filter    Filter[T]
+	unordered bool
+}
+
+func NewParallel[T any](n int, filter Filter[T]) Parallel[T] {
+	if n < 1 {
+		n = 1
+	}
+	return Parallel[T]{n: n, filter: filter}
+}
+
+// Ordered - true (the default) keeps the order of input items, false writes
+// results as soon as they are ready
+func (p Parallel[T]) Ordered(b bool) Parallel[T] {
+	p.unordered = !b
+	return p
+}
+
+// ReadsAsync implements AsyncReader, stdin is read by a dispatcher goroutine
+func (p Parallel[T]) ReadsAsync() bool {
+	return true
+}
+
+func (p Parallel[T]) Unwrap() any {
+	return p.filter
+}
+
+type parallelJob[T any] struct {
+	seq  int
+	item T
+}
+
+type parallelResult[T any] struct {
+	seq int
+	out []T
+	err error
+}
+
+func (p Parallel[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	jobs := make(chan parallelJob[T])
+	results := make(chan parallelResult[T], p.n)
+	// limits items in flight, so reorder buffer does not grow indefinitely
+	slots := make(chan struct{}, 2*p.n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				out, err := p.runItem(ctx, stdio, job.item)
+				select {
+				case results <- parallelResult[T]{seq: job.seq, out: out, err: err}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	readErrCh := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		readErrCh <- p.dispatch(ctx, stdio.Stdin(), jobs, slots)
+	}()
+
+	// on an error, results are drained until all workers and the dispatcher
+	// stop, so nothing touches stdio after Run returns
+	var err error
+	pending := make(map[int][]T)
+	next := 0
+	for result := range results {
+		if err != nil {
+			continue
+		}
+		if result.err != nil {
+			err = result.err
+			cancel(err)
+			continue
+		}
+		if p.unordered {
+			<-slots
+			if err = writeAll(stdio.Stdout(), result.out); err != nil {
+				cancel(err)
+			}
+			continue
+		}
+		pending[result.seq] = result.out
+		for {
+			out, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-slots
+			if err = writeAll(stdio.Stdout(), out); err != nil {
+				cancel(err)
+				break
+			}
+		}
+	}
+	readErr := <-readErrCh
+	if err != nil {
+		return err
+	}
+	return readErr
+}
+
+// dispatch reads items one by one and sends them to workers
+func (p Parallel[T]) dispatch(ctx context.Context, stdin gio.Reader[T], jobs chan<- parallelJob[T], slots chan struct{}) error {
+	buf := make([]T, 1)
+	for seq := 0; ; {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		n, err := stdin.Read(buf)
+		if n == 0 {
+			<-slots
+		} else {
+			select {
+			case jobs <- parallelJob[T]{seq: seq, item: buf[0]}:
+				seq++
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (p Parallel[T]) runItem(ctx context.Context, stdio StandardIO[T], item T) ([]T, error) {
+	out := &sliceWriter[T]{}
+	in := &sliceReader[T]{items: []T{item}}
+	err := p.filter.Run(ctx, derive[T](stdio, in, out))
+	return out.items, stageError(p.filter, err)
+}
+
+func writeAll[T any](w gio.Writer[T], items []T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	_, err := w.Write(items)
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+// Square reads numbers and writes their squares, the smaller number, the
+// longer it takes
+type Square struct{}
+
+func (Square) Run(ctx context.Context, stdio StandardIO[int]) error {
+	buf := make([]int, 1)
+	for {
+		_, err := stdio.Stdin().Read(buf)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if buf[0] == 13 {
+			return errors.New("unlucky")
+		}
+		select {
+		case <-time.After(time.Duration(10-buf[0]%10) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if _, err := stdio.Stdout().Write([]int{buf[0] * buf[0]}); err != nil {
+			return err
+		}
+	}
+}
+
+// Seq writes numbers from 0 to n
+type Seq struct {
+	n int
+}
+
+func (s Seq) Run(ctx context.Context, stdio StandardIO[int]) error {
+	for i := 0; i < s.n; i++ {
+		if _, err := stdio.Stdout().Write([]int{i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type IntBuffer struct {
+	items []int
+}
+
+func (b *IntBuffer) Write(p []int) (int, error) {
+	b.items = append(b.items, p...)
+	return len(p), nil
+}
+
+func TestParallel(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	expected := make([]int, 12)
+	for i := range expected {
+		expected[i] = i * i
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		t.Parallel()
+		out := &IntBuffer{}
+		stdio := NewStdio[int](nil, out, os.Stderr)
+		err := NewLine[int]().Run(ctx, stdio, Seq{n: 12}, NewParallel[int](4, Square{}))
+		require.NoError(t, err)
+		require.Equal(t, expected, out.items)
+	})
+
+	t.Run("unordered", func(t *testing.T) {
+		t.Parallel()
+		out := &IntBuffer{}
+		stdio := NewStdio[int](nil, out, os.Stderr)
+		err := NewLine[int]().Run(ctx, stdio, Seq{n: 12}, NewParallel[int](4, Square{}).Ordered(false))
+		require.NoError(t, err)
+		sort.Ints(out.items)
+		require.Equal(t, expected, out.items)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		out := &IntBuffer{}
+		stdio := NewStdio[int](nil, out, os.Stderr)
+		square := Name[int]("square", Square{})
+		err := NewLine[int]().Run(ctx, stdio, Seq{n: 100}, NewParallel[int](4, square))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "square: unlucky")
+		require.LessOrEqual(t, len(out.items), 13)
+		for i, item := range out.items {
+			require.Equal(t, i*i, item)
+		}
+	})
+
+	t.Run("error waits for workers", func(t *testing.T) {
+		t.Parallel()
+		var running atomic.Int32
+		slow := FilterFunc[int](func(ctx context.Context, stdio StandardIO[int]) error {
+			running.Add(1)
+			defer running.Add(-1)
+			buf := make([]int, 1)
+			if _, err := stdio.Stdin().Read(buf); err != nil {
+				return err
+			}
+			if buf[0] == 0 {
+				// fail when all workers run
+				for running.Load() < 4 {
+					time.Sleep(time.Millisecond)
+				}
+				return errors.New("first")
+			}
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			return ctx.Err()
+		})
+		stdio := NewStdio[int](nil, &IntBuffer{}, os.Stderr)
+		err := NewLine[int]().Run(ctx, stdio, Seq{n: 4}, NewParallel[int](4, slow))
+		require.EqualError(t, Errors(err)[1], "first")
+		require.Zero(t, running.Load())
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		t.Parallel()
+		square := Name[int]("square", Square{})
+		require.Equal(t, "Seq | square", Describe[int](Seq{}, NewParallel[int](2, square)))
+	})
+}
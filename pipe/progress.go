@@ -0,0 +1,237 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a pass-through filter like pv. It counts items and reports
+// the count, rate, progress bar and ETA to stderr periodically.
+//
+//	pipe.NewProgress[string]().Total(1000)
+//
+// By default it is quiet when stderr is not a terminal.
+type Progress[T any] struct {
+	total    int64
+	interval time.Duration
+	quiet    quietMode
+	format   func(int64) string
+	buffer   int
+}
+
+type quietMode int
+
+const (
+	quietAuto quietMode = iota
+	quietOn
+	quietOff
+)
+
+const (
+	defaultProgressInterval = time.Second
+	defaultProgressBuffer   = 512
+)
+
+func NewProgress[T any]() Progress[T] {
+	return Progress[T]{
+		interval: defaultProgressInterval,
+		format:   formatCount,
+		buffer:   defaultProgressBuffer,
+	}
+}
+
+// Total sets an expected number of items, so progress bar and ETA can be computed
+func (p Progress[T]) Total(total int64) Progress[T] {
+	p.total = total
+	return p
+}
+
+// Interval sets how often the progress is reported, a non-positive value
+// means the default of one second
+func (p Progress[T]) Interval(d time.Duration) Progress[T] {
+	p.interval = d
+	return p
+}
+
+// Quiet true never reports progress, false always reports the progress even
+// if stderr is not a terminal
+func (p Progress[T]) Quiet(b bool) Progress[T] {
+	if b {
+		p.quiet = quietOn
+	} else {
+		p.quiet = quietOff
+	}
+	return p
+}
+
+// Format sets how the counts are formatted, so bytes can be shown as KiB,
+// MiB and so.
+func (p Progress[T]) Format(format func(int64) string) Progress[T] {
+	p.format = format
+	return p
+}
+
+// Buffer sets how many items are copied at once, a non-positive value means
+// the default of 512
+func (p Progress[T]) Buffer(n int) Progress[T] {
+	p.buffer = n
+	return p
+}
+
+func (p Progress[T]) Name() string {
+	return "pv"
+}
+
+func (p Progress[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	var count atomic.Int64
+	quiet := p.isQuiet(stdio.Stderr())
+	interval := p.interval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	size := p.buffer
+	if size <= 0 {
+		size = defaultProgressBuffer
+	}
+
+	done := make(chan struct{})
+	reported := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(reported)
+		if quiet {
+			<-done
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				fmt.Fprintf(stdio.Stderr(), "\r%s\n", p.report(count.Load(), time.Since(start)))
+				return
+			case <-ticker.C:
+				fmt.Fprintf(stdio.Stderr(), "\r%s", p.report(count.Load(), time.Since(start)))
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		<-reported
+	}()
+
+	buf := make([]T, size)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := stdio.Stdin().Read(buf)
+		if n > 0 {
+			if _, werr := stdio.Stdout().Write(buf[:n]); werr != nil {
+				return werr
+			}
+			count.Add(int64(n))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (p Progress[T]) isQuiet(stderr io.Writer) bool {
+	switch p.quiet {
+	case quietOn:
+		return true
+	case quietOff:
+		return false
+	}
+	f, ok := stderr.(*os.File)
+	if !ok {
+		return true
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	return stat.Mode()&os.ModeCharDevice == 0
+}
+
+const progressBarWidth = 20
+
+// report returns a line like
+//
+//	1.50k 300/s [=========>          ] 50% ETA 0:00:05
+func (p Progress[T]) report(count int64, elapsed time.Duration) string {
+	format := p.format
+	if format == nil {
+		format = formatCount
+	}
+	var b strings.Builder
+	b.WriteString(format(count))
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(count) / elapsed.Seconds()
+	}
+	fmt.Fprintf(&b, " %s/s", format(int64(rate)))
+	if p.total <= 0 {
+		return b.String()
+	}
+
+	ratio := float64(count) / float64(p.total)
+	if ratio > 1 {
+		ratio = 1
+	}
+	done := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", done)
+	if done < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-done-1)
+	}
+	fmt.Fprintf(&b, " [%s] %3d%%", bar, int(ratio*100))
+	if rate > 0 && count < p.total {
+		eta := time.Duration(float64(p.total-count) / rate * float64(time.Second))
+		fmt.Fprintf(&b, " ETA %s", formatETA(eta))
+	}
+	return b.String()
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+}
+
+func formatCount(n int64) string {
+	return formatUnits(n, 1000, []string{"", "k", "M", "G", "T"})
+}
+
+// FormatBytes formats the number with binary prefixes like 1.50KiB
+func FormatBytes(n int64) string {
+	return formatUnits(n, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB"})
+}
+
+func formatUnits(n int64, base float64, units []string) string {
+	if float64(n) < base {
+		return fmt.Sprintf("%d%s", n, units[0])
+	}
+	f := float64(n)
+	idx := 0
+	for f >= base && idx < len(units)-1 {
+		f /= base
+		idx++
+	}
+	return fmt.Sprintf("%.2f%s", f, units[idx])
+}
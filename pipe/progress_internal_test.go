@@ -0,0 +1,52 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReport(t *testing.T) {
+	p := NewProgress[int]()
+	require.Equal(t, "1.50k 150/s", p.report(1500, 10*time.Second))
+
+	p = p.Total(3000)
+	require.Equal(t, "1.50k 150/s [==========>         ]  50% ETA 0:00:10", p.report(1500, 10*time.Second))
+	require.Equal(t, "3.00k 300/s [====================] 100%", p.report(3000, 10*time.Second))
+
+	p = p.Format(FormatBytes)
+	require.Equal(t, "2.93KiB 300B/s [====================] 100%", p.report(3000, 10*time.Second))
+}
+
+func TestProgressDefaults(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		progress Progress[int]
+	}{
+		{name: "non-positive", progress: NewProgress[int]().Interval(0).Buffer(0)},
+		{name: "zero value", progress: Progress[int]{}},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			out := &sliceWriter[int]{}
+			var stderr bytes.Buffer
+			stdio := NewStdio[int](&sliceReader[int]{items: []int{1, 2, 3}}, out, &stderr)
+			err := tt.progress.Quiet(false).Run(context.Background(), stdio)
+			require.NoError(t, err)
+			require.Equal(t, []int{1, 2, 3}, out.items)
+			require.True(t, strings.HasPrefix(stderr.String(), "\r3 "))
+		})
+	}
+}
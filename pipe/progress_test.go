@@ -0,0 +1,41 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cat := Lines{cat: []string{"three", "small", "pigs"}}
+
+	out := &StringBuffer{}
+	var stderr strings.Builder
+	stdio := NewStdio[string](nil, out, &stderr)
+
+	pv := NewProgress[string]().Total(3).Interval(time.Hour).Quiet(false)
+	err := NewLine[string]().Run(ctx, stdio, cat, pv, CountLines{})
+	require.NoError(t, err)
+	require.Equal(t, "3", out.String())
+	require.True(t, strings.HasPrefix(stderr.String(), "\r3 "))
+	require.True(t, strings.HasSuffix(stderr.String(), "[====================] 100%\n"))
+
+	stderr.Reset()
+	out = &StringBuffer{}
+	stdio = NewStdio[string](nil, out, &stderr)
+	err = NewLine[string]().Run(ctx, stdio, cat, NewProgress[string](), CountLines{})
+	require.NoError(t, err)
+	require.Equal(t, "3", out.String())
+	require.Empty(t, stderr.String())
+}
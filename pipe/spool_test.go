@@ -0,0 +1,37 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio"
+	. "github.com/gomoni/gio/pipe"
+)
+
+func TestLineSpool(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	out := &IntBuffer{}
+	stdio := NewStdio[int](nil, out, os.Stderr)
+	line := NewLine[int]().Spool(0, 2, gio.GobCodec[int]{}, dir)
+	err := line.Run(ctx, stdio, Seq{n: 13}, Square{})
+	require.NoError(t, err)
+	require.Len(t, out.items, 13)
+	require.Equal(t, 12*12, out.items[12])
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	err = line.Checkpoint(NewDirStore(dir), CheckpointEveryWrite).Run(ctx, stdio, Seq{n: 1}, Square{})
+	require.EqualError(t, err, "Error{Code: 1, Err: pipe: spool can't be combined with checkpoint}")
+}
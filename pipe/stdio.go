@@ -23,12 +23,22 @@ type Filter[T any] interface {
 	Run(context.Context, StandardIO[T]) error
 }
 
+// FilterFunc is an adapter to use ordinary function as a Filter
+type FilterFunc[T any] func(context.Context, StandardIO[T]) error
+
+func (f FilterFunc[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	return f(ctx, stdio)
+}
+
 // Stdio represent type safe unix-like standard input and output
 // Implements gio.Standard[T] interface
 type Stdio[T any] struct {
-	stdin  gio.Reader[T]
-	stdout gio.Writer[T]
-	stderr io.Writer
+	stdin    gio.Reader[T]
+	stdout   gio.Writer[T]
+	stderr   io.Writer
+	rejecter rejecter[T]
+	extra    streams
+	env      Environ
 }
 
 func NewStdio[T any](stdin gio.Reader[T], stdout gio.Writer[T], stderr io.Writer) Stdio[T] {
@@ -50,3 +60,10 @@ func (s Stdio[T]) Stdout() gio.Writer[T] {
 func (s Stdio[T]) Stderr() io.Writer {
 	return s.stderr
 }
+
+func (s Stdio[T]) reject(item T, reason error) error {
+	if s.rejecter == nil {
+		return reason
+	}
+	return s.rejecter.reject(item, reason)
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/gomoni/gio"
+)
+
+// streams are additional numbered streams of a Stdio, like fd 3 and more
+// of a unix process
+type streams map[int]stream
+
+// stream is either gio.Reader[U] or gio.Writer[U] for any U
+type stream struct {
+	value  any
+	output bool
+}
+
+type streamer interface {
+	streams() streams
+}
+
+func (s Stdio[T]) streams() streams {
+	return s.extra
+}
+
+// streamsOf returns additional streams of stdio
+func streamsOf[T any](stdio StandardIO[T]) streams {
+	if s, ok := stdio.(streamer); ok {
+		return s.streams()
+	}
+	return nil
+}
+
+// WithInput returns a copy of stdio with an additional input stream fd.
+// Its type does not need to match the stdio.
+//
+//	stdio = pipe.WithInput(stdio, 3, config)
+func WithInput[T, U any](stdio Stdio[T], fd int, r gio.Reader[U]) Stdio[T] {
+	return stdio.with(fd, stream{value: r})
+}
+
+// WithOutput returns a copy of stdio with an additional output stream fd,
+// so filters can emit side outputs like cmd 3>rejects.log does. Stages of
+// a Line share the streams of its stdio, so the writer must be safe for a
+// concurrent use.
+func WithOutput[T, U any](stdio Stdio[T], fd int, w gio.Writer[U]) Stdio[T] {
+	return stdio.with(fd, stream{value: w, output: true})
+}
+
+func (s Stdio[T]) with(fd int, st stream) Stdio[T] {
+	s.extra = maps.Clone(s.extra)
+	if s.extra == nil {
+		s.extra = make(streams)
+	}
+	s.extra[fd] = st
+	return s
+}
+
+// Input returns an additional input stream fd of items U
+//
+//	config, ok := pipe.Input[string](stdio, 3)
+func Input[U, T any](stdio StandardIO[T], fd int) (gio.Reader[U], bool) {
+	st, ok := streamsOf(stdio)[fd]
+	if !ok || st.output {
+		return nil, false
+	}
+	r, ok := st.value.(gio.Reader[U])
+	return r, ok
+}
+
+// Output returns an additional output stream fd of items U
+//
+//	rejects, ok := pipe.Output[string](stdio, 3)
+func Output[U, T any](stdio StandardIO[T], fd int) (gio.Writer[U], bool) {
+	st, ok := streamsOf(stdio)[fd]
+	if !ok || !st.output {
+		return nil, false
+	}
+	w, ok := st.value.(gio.Writer[U])
+	return w, ok
+}
+
+// Fds returns sorted numbers of additional streams of stdio
+func Fds[T any](stdio StandardIO[T]) []int {
+	extra := streamsOf(stdio)
+	fds := make([]int, 0, len(extra))
+	for fd := range extra {
+		fds = append(fds, fd)
+	}
+	slices.Sort(fds)
+	return fds
+}
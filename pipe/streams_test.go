@@ -0,0 +1,88 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+// Evens passes even numbers and writes odd ones to the stream 3
+type Evens struct{}
+
+func (Evens) Run(ctx context.Context, stdio StandardIO[int]) error {
+	odd, ok := Output[string](stdio, 3)
+	if !ok {
+		return errors.New("no stream 3")
+	}
+	buf := make([]int, 1)
+	for {
+		n, err := stdio.Stdin().Read(buf)
+		if n > 0 {
+			if buf[0]%2 == 0 {
+				if _, err := stdio.Stdout().Write(buf[:n]); err != nil {
+					return err
+				}
+			} else if _, err := odd.Write([]string{fmt.Sprintf("odd %d", buf[0])}); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+type stringSink struct {
+	mu    sync.Mutex
+	items []string
+}
+
+func (s *stringSink) Write(p []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, p...)
+	return len(p), nil
+}
+
+func TestStreams(t *testing.T) {
+	t.Parallel()
+	var out IntBuffer
+	var odd stringSink
+	stdio := WithOutput[int, string](NewStdio[int](nil, &out, nil), 3, &odd)
+	require.Equal(t, []int{3}, Fds[int](stdio))
+
+	err := NewLine[int]().Run(context.Background(), stdio, Seq{n: 6}, Evens{})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 2, 4}, out.items)
+	require.Equal(t, []string{"odd 1", "odd 3", "odd 5"}, odd.items)
+
+	_, ok := Input[string](stdio, 3)
+	require.False(t, ok)
+	_, ok = Output[int](stdio, 3)
+	require.False(t, ok)
+	_, ok = Output[string](NewStdio[int](nil, nil, nil), 3)
+	require.False(t, ok)
+
+	in := WithInput[int, string](stdio, 4, lines("a"))
+	r, ok := Input[string](in, 4)
+	require.True(t, ok)
+	buf := make([]string, 1)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, buf[:n])
+	require.Equal(t, []int{3, 4}, Fds[int](in))
+	require.Equal(t, []int{3}, Fds[int](stdio))
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter. The bucket holds up to burst
+// tokens and is refilled by rate tokens per second. It starts full.
+//
+// Rate and burst can be changed while running, waiting callers pick up the
+// new values immediately. Rate zero pauses all callers, rate math.Inf(1)
+// disables the limit.
+type Limiter struct {
+	mu      sync.Mutex
+	clock   Clock
+	rate    float64
+	burst   int
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing rate items per second with bursts
+// of up to burst items
+func NewLimiter(rate float64, burst int) *Limiter {
+	burst = max(burst, 1)
+	return &Limiter{
+		clock:   SystemClock(),
+		rate:    rate,
+		burst:   burst,
+		tokens:  float64(burst),
+		changed: make(chan struct{}),
+	}
+}
+
+// Clock sets a clock, default is SystemClock. It must be called before the
+// limiter is used.
+func (l *Limiter) Clock(clock Clock) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+	l.last = time.Time{}
+	return l
+}
+
+// Rate returns the current rate in items per second
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Burst returns the current size of the bucket
+func (l *Limiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// SetRate changes the rate and wakes up all waiting callers
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.rate = rate
+	l.notify()
+}
+
+// SetBurst changes the size of the bucket and wakes up all waiting callers
+func (l *Limiter) SetBurst(burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.burst = max(burst, 1)
+	l.tokens = math.Min(l.tokens, float64(l.burst))
+	l.notify()
+}
+
+// WaitN blocks until n tokens are available or ctx is done. It fails if n
+// exceeds the burst.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	_, err := l.wait(ctx, n, false)
+	return err
+}
+
+// wait takes n tokens, with partial it takes at most burst tokens and returns
+// the number of taken tokens
+func (l *Limiter) wait(ctx context.Context, n int, partial bool) (int, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		l.mu.Lock()
+		want := n
+		if partial {
+			want = min(n, l.burst)
+		} else if n > l.burst {
+			burst := l.burst
+			l.mu.Unlock()
+			return 0, fmt.Errorf("pipe: limiter wait %d exceeds burst %d", n, burst)
+		}
+		l.refill()
+		if math.IsInf(l.rate, 1) || l.tokens >= float64(want) {
+			l.tokens -= float64(want)
+			l.mu.Unlock()
+			return want, nil
+		}
+		changed := l.changed
+		var timer Timer
+		var expired <-chan time.Time
+		if l.rate > 0 {
+			wait := time.Duration((float64(want) - l.tokens) / l.rate * float64(time.Second))
+			timer = l.clock.NewTimer(max(wait, time.Nanosecond))
+			expired = timer.C()
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// refill adds tokens for the time elapsed since the last refill
+func (l *Limiter) refill() {
+	now := l.clock.Now()
+	if l.last.IsZero() {
+		l.last = now
+		return
+	}
+	if l.rate > 0 && !math.IsInf(l.rate, 1) {
+		elapsed := now.Sub(l.last).Seconds()
+		l.tokens = math.Min(float64(l.burst), l.tokens+elapsed*l.rate)
+	} else if math.IsInf(l.rate, 1) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+}
+
+func (l *Limiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Throttle is a pass-through filter limiting the pace of items by a Limiter.
+// Items are written in chunks of at most burst items. The Limiter can be
+// shared by more filters or changed while running.
+//
+//	pipe.NewThrottle[string](pipe.NewLimiter(100, 10))
+type Throttle[T any] struct {
+	limiter *Limiter
+	buffer  int
+}
+
+func NewThrottle[T any](limiter *Limiter) Throttle[T] {
+	return Throttle[T]{limiter: limiter, buffer: 512}
+}
+
+// Buffer sets how many items are read at once
+func (t Throttle[T]) Buffer(n int) Throttle[T] {
+	t.buffer = max(n, 1)
+	return t
+}
+
+func (t Throttle[T]) Name() string {
+	return "throttle"
+}
+
+func (t Throttle[T]) Run(ctx context.Context, stdio StandardIO[T]) error {
+	buf := make([]T, t.buffer)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := stdio.Stdin().Read(buf)
+		for chunk := buf[:n]; len(chunk) > 0; {
+			size, werr := t.limiter.wait(ctx, len(chunk), true)
+			if werr != nil {
+				return werr
+			}
+			if _, werr := stdio.Stdout().Write(chunk[:size]); werr != nil {
+				return werr
+			}
+			chunk = chunk[size:]
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
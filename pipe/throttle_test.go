@@ -0,0 +1,82 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package pipe_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/pipe"
+)
+
+func waitTimers(t *testing.T, clock *ManualClock, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return clock.Timers() == n }, time.Second, time.Millisecond)
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clock := NewManualClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(2, 2).Clock(clock)
+
+	// bucket starts full
+	require.NoError(t, limiter.WaitN(ctx, 2))
+	require.EqualError(t, limiter.WaitN(ctx, 3), "pipe: limiter wait 3 exceeds burst 2")
+
+	done := make(chan error, 1)
+	go func() { done <- limiter.WaitN(ctx, 1) }()
+	waitTimers(t, clock, 1)
+	clock.Advance(499 * time.Millisecond)
+	require.Len(t, done, 0)
+	clock.Advance(time.Millisecond)
+	require.NoError(t, <-done)
+
+	// rate zero pauses until the rate changes
+	limiter.SetRate(0)
+	go func() { done <- limiter.WaitN(ctx, 1) }()
+	clock.Advance(time.Hour)
+	require.Len(t, done, 0)
+	limiter.SetRate(math.Inf(1))
+	require.NoError(t, <-done)
+	require.True(t, math.IsInf(limiter.Rate(), 1))
+
+	// cancel of a waiting caller
+	limiter.SetRate(1)
+	require.NoError(t, limiter.WaitN(ctx, 2))
+	ctx2, cancel := context.WithCancel(ctx)
+	go func() { done <- limiter.WaitN(ctx2, 1) }()
+	waitTimers(t, clock, 1)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clock := NewManualClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(10, 5).Clock(clock)
+
+	out := &IntBuffer{}
+	stdio := NewStdio[int](nil, out, os.Stderr)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewLine[int]().Run(ctx, stdio, Seq{n: 12}, NewThrottle[int](limiter))
+	}()
+
+	// 5 items go immediately, then 10 items per second
+	waitTimers(t, clock, 1)
+	clock.Advance(500 * time.Millisecond)
+	waitTimers(t, clock, 1)
+	require.Len(t, done, 0)
+	clock.Advance(200 * time.Millisecond)
+	require.NoError(t, <-done)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, out.items)
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package gio
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// spool is a FIFO queue of items in memory, which continues in a segment
+// file on disk when the memory part is full. Items written while the disk
+// part is not empty go to the disk too, so the order is kept.
+type spool[T any] struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	codec Codec[T]
+	dir   string
+
+	mem  []T
+	head int
+
+	file    *os.File
+	r       *os.File
+	w       *bufio.Writer
+	enc     Encoder[T]
+	dec     Decoder[T]
+	onDisk  int
+	rclosed bool
+	wclosed bool
+	rerr    error
+	werr    error
+}
+
+func (s *spool[T]) read(data []T) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.rclosed && !s.wclosed && s.head == len(s.mem) && s.onDisk == 0 {
+		s.cond.Wait()
+	}
+	if s.rclosed {
+		return 0, io.ErrClosedPipe
+	}
+	if s.head < len(s.mem) {
+		n := copy(data, s.mem[s.head:])
+		clear(s.mem[s.head : s.head+n])
+		s.head += n
+		if s.head == len(s.mem) {
+			s.mem, s.head = s.mem[:0], 0
+		}
+		return n, nil
+	}
+	if s.onDisk > 0 {
+		return s.readDisk(data)
+	}
+	return 0, s.werr
+}
+
+// readDisk decodes items from the segment file, which is reset when all
+// items were read
+func (s *spool[T]) readDisk(data []T) (int, error) {
+	n := 0
+	for ; n < len(data) && s.onDisk > 0; n++ {
+		if err := s.dec.Decode(&data[n]); err != nil {
+			return n, err
+		}
+		s.onDisk--
+	}
+	if s.onDisk > 0 {
+		return n, nil
+	}
+	if err := s.resetDisk(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (s *spool[T]) resetDisk() error {
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := s.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.w.Reset(s.file)
+	s.enc = s.codec.NewEncoder(s.w)
+	s.dec = s.codec.NewDecoder(bufio.NewReader(s.r))
+	return nil
+}
+
+func (s *spool[T]) openDisk() error {
+	f, err := os.CreateTemp(s.dir, "gio-spool-*")
+	if err != nil {
+		return err
+	}
+	r, err := os.Open(f.Name())
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	s.file, s.r = f, r
+	s.w = bufio.NewWriter(f)
+	s.enc = s.codec.NewEncoder(s.w)
+	s.dec = s.codec.NewDecoder(bufio.NewReader(r))
+	return nil
+}
+
+func (s *spool[T]) write(data []T) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rclosed {
+		if s.rerr != nil {
+			return 0, s.rerr
+		}
+		return 0, io.ErrClosedPipe
+	}
+	if s.wclosed {
+		return 0, io.ErrClosedPipe
+	}
+	defer s.cond.Broadcast()
+
+	n := 0
+	for ; n < len(data) && s.onDisk == 0 && (s.codec == nil || len(s.mem)-s.head < s.limit); n++ {
+		s.mem = append(s.mem, data[n])
+	}
+	if n == len(data) {
+		return n, nil
+	}
+	if s.file == nil {
+		if err := s.openDisk(); err != nil {
+			return n, err
+		}
+	}
+	for _, item := range data[n:] {
+		if err := s.enc.Encode(item); err != nil {
+			return n, err
+		}
+		n++
+		s.onDisk++
+	}
+	// a reader decodes only flushed items
+	if err := s.w.Flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (s *spool[T]) closeRead(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.rclosed {
+		s.rclosed = true
+		s.rerr = err
+	}
+	s.mem, s.head, s.onDisk = nil, 0, 0
+	s.cond.Broadcast()
+	return s.removeDisk()
+}
+
+func (s *spool[T]) closeWrite(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		err = io.EOF
+	}
+	if !s.wclosed {
+		s.wclosed = true
+		s.werr = err
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+func (s *spool[T]) removeDisk() error {
+	if s.file == nil {
+		return nil
+	}
+	s.r.Close()
+	s.file.Close()
+	err := os.Remove(s.file.Name())
+	s.file, s.r = nil, nil
+	return err
+}
+
+// A SpoolReader is the read half of a spool pipe.
+type SpoolReader[T any] struct {
+	s *spool[T]
+}
+
+// Read reads items in the order they were written, blocking until a write
+// or until the write end is closed. After the write end is closed, all
+// buffered items are read first, then the error of CloseWithError or EOF
+// is returned.
+func (r *SpoolReader[T]) Read(data []T) (int, error) {
+	return r.s.read(data)
+}
+
+// Close closes the reader, drops all buffered items and removes the
+// segment file. Subsequent writes return ErrClosedPipe.
+func (r *SpoolReader[T]) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError closes the reader; subsequent writes return the error
+// err or ErrClosedPipe if err is nil.
+func (r *SpoolReader[T]) CloseWithError(err error) error {
+	return r.s.closeRead(err)
+}
+
+// A SpoolWriter is the write half of a spool pipe.
+type SpoolWriter[T any] struct {
+	s *spool[T]
+}
+
+// Write buffers items and never blocks on a reader. It fails if the reader
+// is closed or when items can't be written to the segment file.
+func (w *SpoolWriter[T]) Write(data []T) (int, error) {
+	return w.s.write(data)
+}
+
+// Close closes the writer; reads return EOF once all buffered items are
+// read.
+func (w *SpoolWriter[T]) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError closes the writer; reads return the error err or EOF if
+// err is nil, once all buffered items are read.
+func (w *SpoolWriter[T]) CloseWithError(err error) error {
+	return w.s.closeWrite(err)
+}
+
+// SpoolPipe creates an asynchronous pipe with an unbounded buffer. Up to
+// limit items are buffered in memory, more items are encoded by codec to a
+// segment file in dir, os.TempDir if empty. The file is truncated whenever
+// all its items are read and removed when the reader is closed, so the
+// reader must be closed. A nil codec buffers everything in memory.
+//
+// Unlike Pipe, Write does not wait on a reader, so a fast producer is not
+// blocked by a slow consumer.
+func SpoolPipe[T any](limit int, codec Codec[T], dir string) (*SpoolReader[T], *SpoolWriter[T]) {
+	s := &spool[T]{limit: limit, codec: codec, dir: dir}
+	s.cond = sync.NewCond(&s.mu)
+	return &SpoolReader[T]{s: s}, &SpoolWriter[T]{s: s}
+}
@@ -0,0 +1,91 @@
+package gio_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio"
+)
+
+func TestSpoolPipe(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		codec Codec[int]
+	}{
+		{"gob", GobCodec[int]{}},
+		{"json", JSONCodec[int]{}},
+		{"memory", nil},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			r, w := SpoolPipe[int](3, tt.codec, dir)
+
+			// does not block on a reader
+			_, err := w.Write([]int{1, 2, 3, 4, 5})
+			require.NoError(t, err)
+			buf := make([]int, 3)
+			n, err := r.Read(buf)
+			require.NoError(t, err)
+			require.Equal(t, []int{1, 2, 3}, buf[:n])
+
+			// goes to disk after spilled items, so the order is kept
+			_, err = w.Write([]int{6})
+			require.NoError(t, err)
+			n, err = r.Read(buf)
+			require.NoError(t, err)
+			require.Equal(t, []int{4, 5, 6}, buf[:n])
+
+			// disk is empty again, so items go to memory
+			_, err = w.Write([]int{7, 8, 9, 10})
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			got, err := readAll[int](t, r)
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, []int{7, 8, 9, 10}, got)
+
+			require.NoError(t, r.Close())
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestSpoolPipeClose(t *testing.T) {
+	t.Parallel()
+	boom := errors.New("boom")
+
+	r, w := SpoolPipe[int](1, GobCodec[int]{}, t.TempDir())
+	done := make(chan error, 1)
+	var got []int
+	go func() {
+		var err error
+		got, err = readAll[int](t, r)
+		done <- err
+	}()
+	time.Sleep(time.Millisecond)
+	_, err := w.Write([]int{1, 2})
+	require.NoError(t, err)
+	w.CloseWithError(boom)
+	require.ErrorIs(t, <-done, boom)
+	require.Equal(t, []int{1, 2}, got)
+
+	r, w = SpoolPipe[int](1, GobCodec[int]{}, t.TempDir())
+	_, err = w.Write([]int{1, 2})
+	require.NoError(t, err)
+	r.CloseWithError(boom)
+	_, err = w.Write([]int{3})
+	require.ErrorIs(t, err, boom)
+	_, err = r.Read(make([]int, 1))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
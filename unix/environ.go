@@ -0,0 +1,53 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+// WithEnviron returns a copy of stdio with an environment e, see
+// pipe.Environ
+func (s Stdio) WithEnviron(e pipe.Environ) Stdio {
+	s.env = e
+	return s
+}
+
+// EnvironOf returns the environment of stdio, a zero pipe.Environ if there
+// is none
+func EnvironOf(stdio StandardIO) pipe.Environ {
+	if s, ok := stdio.(Stdio); ok {
+		return s.env
+	}
+	return pipe.Environ{}
+}
+
+// Scope runs a filter with a changed environment, so the change does not
+// leak to other stages, like (cd dir && cmd) in a shell.
+//
+//	unix.Scope(func(e pipe.Environ) pipe.Environ { return e.Chdir("dir") }, cmd)
+func Scope(change func(pipe.Environ) pipe.Environ, filter Filter) Filter {
+	return scoped{change: change, filter: filter}
+}
+
+type scoped struct {
+	change func(pipe.Environ) pipe.Environ
+	filter Filter
+}
+
+func (s scoped) Name() string {
+	return "(" + pipe.FilterName(s.filter) + ")"
+}
+
+func (s scoped) Unwrap() any {
+	return s.filter
+}
+
+func (s scoped) Run(ctx context.Context, stdio StandardIO) error {
+	scoped := derive(stdio, stdio.Stdin(), stdio.Stdout(), stdio.Stderr())
+	return s.filter.Run(ctx, scoped.WithEnviron(s.change(EnvironOf(stdio))))
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	environ := pipe.Environ{}.Setenv("GIO_ENVIRON", "x").Chdir(dir)
+
+	var out strings.Builder
+	stdio := NewStdio(strings.NewReader(""), &out, nil).WithEnviron(environ)
+	pwd := NewCmd(exec.Command("sh", "-c", `echo "$GIO_ENVIRON $(pwd)"`))
+	cd := func(e pipe.Environ) pipe.Environ { return e.Chdir("sub").Setenv("GIO_ENVIRON", "y") }
+	scoped := Scope(cd, pwd)
+	require.Equal(t, "(sh -c echo \"$GIO_ENVIRON $(pwd)\")", pipe.FilterName(scoped))
+
+	for _, filter := range []Filter{pwd, scoped, pwd} {
+		require.NoError(t, NewLine().Run(context.Background(), stdio, filter))
+	}
+	require.Equal(t, "x "+dir+"\ny "+dir+"/sub\nx "+dir+"\n", out.String())
+}
+
+func TestEnvironUmask(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	environ := pipe.Environ{}.Chdir(dir).WithUmask(0o077)
+	stdio := NewStdio(strings.NewReader(""), nil, nil).WithEnviron(environ)
+
+	err := NewLine().Run(
+		context.Background(),
+		stdio,
+		NewCmd(exec.Command("sh", "-c", `touch cmd; echo native`)),
+		Redirect(NewCmd(exec.Command("cat")), ToFile("native")),
+	)
+	require.NoError(t, err)
+	for _, name := range []string{"cmd", "native"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm(), name)
+	}
+
+	// arguments and an exit code are kept
+	var out strings.Builder
+	stdio = NewStdio(strings.NewReader(""), &out, nil).WithEnviron(environ)
+	err = NewLine().Run(
+		context.Background(),
+		stdio,
+		NewCmd(exec.Command("sh", "-c", `echo "$1"; umask; exit 3`, "sh", "a b")),
+	)
+	var pipeErr pipe.Error
+	require.ErrorAs(t, err, &pipeErr)
+	require.Equal(t, 3, pipeErr.Code)
+	require.Equal(t, "a b\n0077\n", out.String())
+
+	// a missing command fails the same way as without the umask
+	missing := filepath.Join(dir, "missing")
+	err = NewCmd(exec.Command(missing)).Run(context.Background(), stdio)
+	require.ErrorAs(t, err, &pipeErr)
+	require.ErrorIs(t, pipeErr.Err, os.ErrNotExist)
+	plain := NewCmd(exec.Command(missing)).Run(context.Background(), NewStdio(nil, nil, nil))
+	require.Equal(t, plain, err)
+}
@@ -2,7 +2,12 @@ package unix
 
 import (
 	"context"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gomoni/gio/pipe"
 )
@@ -10,6 +15,21 @@ import (
 // Exec is a wrapper of os/exec.Cmd providing a Filter compatible interface
 type Cmd struct {
 	cmd *exec.Cmd
+	// stdin and stdout are set by Line to connect commands directly
+	stdin  *os.File
+	stdout *os.File
+	// owned files are closed once the command starts
+	owned []*os.File
+
+	signal os.Signal
+	grace  time.Duration
+	group  bool
+	setsid bool
+	job    *Job
+	slot   *jobSlot
+	limits Limits
+	pty    *Pty
+	substs []substArg
 }
 
 // NewCmd wraps exec.Cmd. The intended usage is
@@ -19,7 +39,64 @@ func NewCmd(cmd *exec.Cmd) Cmd {
 	if cmd == nil {
 		panic("cmd is nil")
 	}
-	return Cmd{cmd}
+	return Cmd{cmd: cmd}
+}
+
+// Terminate sends sig instead of SIGKILL when a context is canceled. If the
+// command does not exit within grace, it is killed. Zero grace waits until
+// the command exits.
+func (c Cmd) Terminate(sig os.Signal, grace time.Duration) Cmd {
+	c.signal = sig
+	c.grace = grace
+	return c
+}
+
+// ProcessGroup runs the command in a new process group and signals the
+// whole group on a cancel, so children spawned by the command are not
+// orphaned. Remaining members of the group are killed once the command
+// exits after a cancel. It sets SysProcAttr.Setpgid on unix and does
+// nothing elsewhere.
+func (c Cmd) ProcessGroup(b bool) Cmd {
+	c.group = b
+	return c
+}
+
+// Setsid runs the command in a new session, so it is detached from a
+// controlling terminal. A session leader can't join a process group of a
+// Job, so Run fails if the command runs in a Line with a Job.
+func (c Cmd) Setsid(b bool) Cmd {
+	c.setsid = b
+	return c
+}
+
+// SignalError is returned as pipe.Error.Err when a command was terminated
+// by a signal. The Code is pipe.Signaled plus a signal number.
+type SignalError struct {
+	Signal os.Signal
+	Err    error
+}
+
+func (e *SignalError) Error() string {
+	return "signal: " + e.Signal.String()
+}
+
+func (e *SignalError) Unwrap() error {
+	return e.Err
+}
+
+// Name implements pipe.Named interface, so the argv is used as a name of the
+// stage.
+func (c Cmd) Name() string {
+	if len(c.substs) == 0 {
+		return strings.Join(c.cmd.Args, " ")
+	}
+	args := slices.Clone(c.cmd.Args)
+	for _, s := range c.substs {
+		if s.arg > 0 && s.arg < len(args) {
+			args[s.arg] = s.subst.String()
+		}
+	}
+	return strings.Join(args, " ")
 }
 
 // Run implements Filter interface for Cmd wrapper. It creates a _new_ instance of
@@ -27,22 +104,190 @@ func NewCmd(cmd *exec.Cmd) Cmd {
 //
 // Returns a [pipe.Error] if Run results in [*exec.ExitError]. Code is ExitCode and
 // Err is the *exec.ExitError
+//
+// Additional streams of stdio, see Stdio.WithOutput, are passed as file
+// descriptors 3 and more and override ExtraFiles of the wrapped exec.Cmd.
+//
+// The command inherits pipe.Environ of stdio, see Stdio.WithEnviron. Env of
+// the wrapped exec.Cmd replaces the environment and its Dir is relative to
+// the working directory of the Environ. Its umask is set as the process umask
+// while the command starts, so files created by other goroutines meanwhile
+// get it too.
 func (c Cmd) Run(ctx context.Context, stdio StandardIO) error {
+	// other commands of a job do not wait for one which fails to start
+	defer c.slot.leave()
+	environ := EnvironOf(stdio)
 	cmd := exec.CommandContext(ctx, c.cmd.Path, c.cmd.Args[1:]...)
 	cmd.Env = c.cmd.Env
-	cmd.Dir = c.cmd.Dir
+	if cmd.Env == nil {
+		cmd.Env = environ.Environ()
+	}
+	cmd.Dir = environ.Path(c.cmd.Dir)
+	if c.cmd.Dir == "" {
+		cmd.Dir = environ.Dir()
+	}
 
 	cmd.Stdin = stdio.Stdin()
+	if c.stdin != nil {
+		cmd.Stdin = c.stdin
+	}
 	cmd.Stdout = stdio.Stdout()
+	if c.stdout != nil {
+		cmd.Stdout = c.stdout
+	}
 	cmd.Stderr = stdio.Stderr()
 
-	cmd.ExtraFiles = c.cmd.ExtraFiles
 	cmd.SysProcAttr = c.cmd.SysProcAttr
 	cmd.WaitDelay = c.cmd.WaitDelay
+	if c.setsid && c.job != nil {
+		c.closeOwned()
+		return pipe.NewErrorf(1, "unix: %s: setsid can't be used in a job", c.Name())
+	}
+	var term *terminal
+	if c.pty != nil {
+		if c.job != nil {
+			c.closeOwned()
+			return pipe.NewErrorf(1, "unix: %s: pty can't be used in a job", c.Name())
+		}
+		t, err := openTerminal(*c.pty)
+		if err != nil {
+			c.closeOwned()
+			return pipe.NewErrorf(1, "unix: %s: %w", c.Name(), err)
+		}
+		term = t
+		term.attach(cmd)
+		// the terminal copies from and to owned files
+		defer c.closeOwned()
+	}
+	group := c.group || c.job != nil
+	if c.setsid {
+		setSession(cmd)
+	} else if c.group && c.job == nil && term == nil {
+		// a session leader of a terminal is a group leader already
+		setProcessGroup(cmd, 0)
+	}
+	if c.grace > 0 && cmd.WaitDelay == 0 {
+		// do not wait on pipes held by children after a grace period
+		cmd.WaitDelay = c.grace
+	}
 
-	err := cmd.Run()
+	extra, err := newExtraFiles(stdio, c.cmd.ExtraFiles)
+	if err != nil {
+		if term != nil {
+			term.close()
+		}
+		c.closeOwned()
+		return pipe.NewErrorf(1, "unix: %s: %w", c.Name(), err)
+	}
+	cmd.ExtraFiles = extra.files
+	subst, err := c.substitute(cmd)
+	mask, hasUmask := environ.Umask()
+	if err == nil && c.limits != (Limits{}) {
+		// the helper executes the final argv
+		spec := limitsSpec{Limits: c.limits}
+		if hasUmask {
+			spec.Umask = &mask
+			hasUmask = false
+		}
+		err = spec.wrap(cmd)
+	}
+	if err != nil {
+		subst.close()
+		extra.close()
+		if term != nil {
+			term.close()
+		}
+		c.closeOwned()
+		return pipe.NewErrorf(1, "unix: %s: %w", c.Name(), err)
+	}
+
+	var mu sync.Mutex
+	var kill *time.Timer
+	var pgid int
+	if c.signal != nil || group {
+		sig := c.signal
+		if sig == nil {
+			sig = os.Kill
+		}
+		cmd.Cancel = func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			if c.grace > 0 && sig != os.Kill {
+				kill = time.AfterFunc(c.grace, func() { signal(cmd.Process, os.Kill, pgid) })
+			}
+			return signal(cmd.Process, sig, pgid)
+		}
+	}
+
+	start := cmd.Start
+	if c.job != nil {
+		start = func() error { return c.job.start(cmd) }
+	}
+	if hasUmask {
+		err = startUmask(mask, start)
+	} else {
+		err = start()
+	}
+	// the child has own copies, so the other end of os.Pipe sees EOF when
+	// the child exits
+	if err != nil {
+		extra.close()
+		subst.close()
+	} else {
+		extra.start()
+		subst.start(ctx, stdio)
+	}
+	if term == nil {
+		c.closeOwned()
+	} else if err != nil {
+		term.close()
+	} else {
+		term.start()
+	}
+	if err == nil && group {
+		mu.Lock()
+		pgid = cmd.Process.Pid
+		if c.job != nil {
+			pgid = c.job.Pgid()
+		}
+		mu.Unlock()
+	}
+	if c.job != nil {
+		// the group must exist until all processes join it
+		c.slot.arrive(ctx)
+	}
+	if err == nil {
+		err = cmd.Wait()
+		mu.Lock()
+		if kill != nil {
+			kill.Stop()
+		}
+		mu.Unlock()
+		if group && ctx.Err() != nil {
+			// do not leave orphans
+			signal(cmd.Process, os.Kill, pgid)
+		}
+		if eerr := extra.wait(); err == nil {
+			err = eerr
+		}
+		subst.wait()
+		if term != nil {
+			if terr := term.wait(); err == nil {
+				err = terr
+			}
+		}
+	}
 	if err == nil {
 		return nil
 	}
+	if sig, signo, ok := exitSignal(err); ok {
+		return pipe.NewError(pipe.Signaled+signo, &SignalError{Signal: sig, Err: err})
+	}
 	return pipe.FromError(err)
 }
+
+func (c Cmd) closeOwned() {
+	for _, f := range c.owned {
+		f.Close()
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package unix
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+const (
+	// CPULimit and FileSizeLimit are codes of commands killed after they
+	// exceeded Limits, which are not supported here, so no command exits
+	// with them
+	CPULimit      = -1
+	FileSizeLimit = -2
+)
+
+func setProcessGroup(*exec.Cmd, int) {}
+
+func setSession(*exec.Cmd) {}
+
+func startUmask(os.FileMode, func() error) error {
+	return errors.New("unix: umask is supported on unix only")
+}
+
+func signal(p *os.Process, sig os.Signal, _ int) error {
+	return p.Signal(sig)
+}
+
+func signalGroup(int, os.Signal) error {
+	return errors.New("unix: process groups are not supported")
+}
+
+func exitSignal(error) (os.Signal, int, bool) {
+	return nil, 0, false
+}
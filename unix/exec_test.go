@@ -64,3 +64,70 @@ func TestNotFound(t *testing.T) {
 	require.Equal(t, pipe.NotFound, pipeErr.Code)
 	require.True(t, strings.Contains(pipeErr.Error(), "executable file not found"))
 }
+
+func TestCmdName(t *testing.T) {
+	grep := NewCmd(exec.Command("grep", "foo"))
+	wc := NewCmd(exec.Command("wc", "-l"))
+	require.Equal(t, "grep foo", grep.Name())
+	require.Equal(t, "grep foo | wc -l", Describe(grep, wc))
+}
+
+func TestLineError(t *testing.T) {
+	ctx := context.Background()
+	stdio := NewStdio(strings.NewReader(""), nil, nil)
+
+	err := NewLine().Run(ctx, stdio, NewCmd(exec.Command("false")))
+	pipeErr, ok := err.(pipe.Error)
+	require.True(t, ok)
+	require.Equal(t, 1, pipeErr.Code)
+	var stageErr pipe.StageError
+	require.ErrorAs(t, pipeErr.Err, &stageErr)
+	require.Equal(t, "false", stageErr.Name)
+
+	err = NewLine().Run(ctx, stdio, NewCmd(exec.Command("false")), NewCmd(exec.Command("cat")))
+	pipeErr, ok = err.(pipe.Error)
+	require.True(t, ok)
+	require.Equal(t, 1, pipeErr.Code)
+	require.Len(t, pipe.Errors(err), 2)
+}
+
+func TestDirectPipe(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	in, err := os.Create(dir + "/in")
+	require.NoError(t, err)
+	_, err = in.WriteString("three\nsmall\npigs\n")
+	require.NoError(t, err)
+	_, err = in.Seek(0, 0)
+	require.NoError(t, err)
+	defer in.Close()
+	out, err := os.Create(dir + "/out")
+	require.NoError(t, err)
+	defer out.Close()
+
+	recorder := &pipe.Recorder{}
+	stdio := NewStdio(in, out, os.Stderr)
+	err = NewLine().Observe(recorder).Run(ctx, stdio,
+		NewCmd(exec.Command("tr", "a-z", "A-Z")),
+		NewCmd(exec.Command("sort")),
+		NewCmd(exec.Command("head", "-n", "2")),
+	)
+	require.NoError(t, err)
+	// nothing goes through gio.Pipe
+	require.Empty(t, recorder.Events(pipe.EventRead, pipe.EventWrite))
+
+	b, err := os.ReadFile(dir + "/out")
+	require.NoError(t, err)
+	require.Equal(t, "PIGS\nSMALL\n", string(b))
+
+	// Go filters in the middle still work
+	var stdout bytes.Buffer
+	stdio = NewStdio(bytes.NewBufferString("three\nsmall\npigs\n"), &stdout, os.Stderr)
+	err = NewLine().Run(ctx, stdio,
+		NewCmd(exec.Command("tr", "a-z", "A-Z")),
+		NewCmd(exec.Command("sort")),
+		CountLines{},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "3\n", stdout.String())
+}
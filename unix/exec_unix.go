@@ -0,0 +1,95 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package unix
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+const (
+	// CPULimit is a code of a command killed by SIGXCPU after it exceeded
+	// Limits.CPU
+	CPULimit = pipe.Signaled + int(syscall.SIGXCPU)
+	// FileSizeLimit is a code of a command killed by SIGXFSZ after it
+	// exceeded Limits.FileSize
+	FileSizeLimit = pipe.Signaled + int(syscall.SIGXFSZ)
+)
+
+func sysProcAttr(cmd *exec.Cmd) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	if cmd.SysProcAttr != nil {
+		copied := *cmd.SysProcAttr
+		attr = &copied
+	}
+	cmd.SysProcAttr = attr
+	return attr
+}
+
+// setProcessGroup puts the command to a process group pgid, zero creates a
+// new one
+func setProcessGroup(cmd *exec.Cmd, pgid int) {
+	attr := sysProcAttr(cmd)
+	attr.Setpgid = true
+	attr.Pgid = pgid
+}
+
+func setSession(cmd *exec.Cmd) {
+	sysProcAttr(cmd).Setsid = true
+}
+
+// umaskMu serializes starts of commands with an umask
+var umaskMu sync.Mutex
+
+// startUmask calls start with the process umask set to mask, so the child
+// inherits it at fork. Files created by other goroutines in the meantime
+// get the mask too.
+func startUmask(mask os.FileMode, start func() error) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(int(mask.Perm()))
+	defer syscall.Umask(old)
+	return start()
+}
+
+// signal sends sig to a process or to a process group if pgid is not zero
+func signal(p *os.Process, sig os.Signal, pgid int) error {
+	if pgid == 0 {
+		return p.Signal(sig)
+	}
+	return signalGroup(pgid, sig)
+}
+
+func signalGroup(pgid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.New("unix: unsupported signal " + sig.String())
+	}
+	err := syscall.Kill(-pgid, s)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// exitSignal returns a signal which terminated a command
+func exitSignal(err error) (os.Signal, int, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil, 0, false
+	}
+	return status.Signal(), int(status.Signal()), true
+}
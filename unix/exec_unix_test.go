@@ -0,0 +1,226 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package unix_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+func runCanceled(t *testing.T, cmd Cmd) (error, time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := cmd.Run(ctx, NewStdio(nil, nil, nil))
+	return err, time.Since(start)
+}
+
+func TestTerminate(t *testing.T) {
+	t.Parallel()
+	t.Run("signal", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewCmd(exec.Command("sleep", "10")).Terminate(syscall.SIGTERM, 5*time.Second)
+		err, took := runCanceled(t, cmd)
+		require.Less(t, took, 5*time.Second)
+
+		var pipeErr pipe.Error
+		require.ErrorAs(t, err, &pipeErr)
+		require.Equal(t, 143, pipeErr.Code)
+		var sigErr *SignalError
+		require.ErrorAs(t, pipeErr.Err, &sigErr)
+		require.Equal(t, syscall.SIGTERM, sigErr.Signal)
+		require.EqualError(t, sigErr, "signal: terminated")
+	})
+
+	t.Run("trap", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewCmd(exec.Command("sh", "-c", `trap "exit 3" TERM; sleep 10 & wait`)).Terminate(syscall.SIGTERM, 5*time.Second)
+		err, took := runCanceled(t, cmd)
+		require.Less(t, took, 5*time.Second)
+		var pipeErr pipe.Error
+		require.ErrorAs(t, err, &pipeErr)
+		require.Equal(t, 3, pipeErr.Code)
+	})
+
+	t.Run("grace", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewCmd(exec.Command("sh", "-c", `trap "" TERM; while true; do sleep 0.01; done`)).
+			Terminate(syscall.SIGTERM, 200*time.Millisecond).
+			ProcessGroup(true)
+		err, took := runCanceled(t, cmd)
+		require.GreaterOrEqual(t, took, 300*time.Millisecond)
+		var pipeErr pipe.Error
+		require.ErrorAs(t, err, &pipeErr)
+		require.Equal(t, 137, pipeErr.Code)
+	})
+}
+
+func TestProcessGroup(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer pr.Close()
+
+	cmd := NewCmd(exec.Command("sh", "-c", `trap "" TERM; sleep 100 & echo $!; wait`)).
+		Terminate(syscall.SIGTERM, 100*time.Millisecond).
+		ProcessGroup(true)
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, NewStdio(nil, pw, os.Stderr))
+		pw.Close()
+	}()
+
+	line, err := bufio.NewReader(pr).ReadString('\n')
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	require.NoError(t, err)
+	cancel()
+	require.Error(t, <-done)
+
+	// the background sleep is killed or a zombie waiting for a reaper
+	require.Eventually(t, func() bool {
+		err := syscall.Kill(pid, 0)
+		if errors.Is(err, syscall.ESRCH) {
+			return true
+		}
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		return err == nil && strings.Contains(string(stat), ") Z ")
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestJob(t *testing.T) {
+	t.Parallel()
+	t.Run("pgid", func(t *testing.T) {
+		t.Parallel()
+		job := NewJob()
+		require.ErrorIs(t, job.Signal(syscall.SIGTERM), ErrJobNotStarted)
+
+		var out strings.Builder
+		err := NewLine().Job(job).Run(
+			context.Background(),
+			NewStdio(strings.NewReader(""), &out, nil),
+			NewCmd(exec.Command("sh", "-c", `ps -o pgid= -p $$`)),
+			NewCmd(exec.Command("sh", "-c", `cat; ps -o pgid= -p $$`)),
+		)
+		require.NoError(t, err)
+		pgids := strings.Fields(out.String())
+		require.Len(t, pgids, 2)
+		require.Equal(t, pgids[0], pgids[1])
+		require.Equal(t, strconv.Itoa(job.Pgid()), pgids[0])
+		require.NotEqual(t, strconv.Itoa(syscall.Getpgrp()), pgids[0])
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		t.Parallel()
+		job := NewJob()
+		done := make(chan error, 1)
+		go func() {
+			done <- NewLine().Pipefail(true).Job(job).Run(
+				context.Background(),
+				NewStdio(strings.NewReader(""), nil, nil),
+				NewCmd(exec.Command("sleep", "10")),
+				NewCmd(exec.Command("sleep", "10")),
+			)
+		}()
+		require.Eventually(t, func() bool { return job.Pgid() != 0 }, 2*time.Second, 10*time.Millisecond)
+		require.NoError(t, job.Signal(syscall.SIGTERM))
+
+		select {
+		case err := <-done:
+			var pipeErr pipe.Error
+			require.ErrorAs(t, err, &pipeErr)
+			require.Equal(t, 143, pipeErr.Code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("job was not terminated")
+		}
+	})
+
+	t.Run("setsid", func(t *testing.T) {
+		t.Parallel()
+		err := NewLine().Job(NewJob()).Run(
+			context.Background(),
+			NewStdio(strings.NewReader(""), nil, nil),
+			NewCmd(exec.Command("true")).Setsid(true),
+		)
+		require.Error(t, err)
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		testCases := []struct {
+			name  string
+			first Filter
+		}{
+			{"setsid", NewCmd(exec.Command("true")).Setsid(true)},
+			{"redirect", Redirect(NewCmd(exec.Command("true")), FromFile(dir+"/missing"))},
+		}
+		for _, tt := range testCases {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				// the other command must not wait for the one which never starts
+				err := NewLine().Pipefail(false).Job(NewJob()).Run(
+					ctx,
+					NewStdio(strings.NewReader(""), nil, nil),
+					tt.first,
+					NewCmd(exec.Command("cat")),
+				)
+				require.NoError(t, err)
+				require.NoError(t, ctx.Err())
+			})
+		}
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		t.Parallel()
+		job := NewJob()
+		var out strings.Builder
+		err := NewLine().Job(job).Run(
+			context.Background(),
+			NewStdio(strings.NewReader(""), &out, nil),
+			Redirect(NewCmd(exec.Command("sh", "-c", `ps -o pgid= -p $$`)), FromNull()),
+			Scope(func(e pipe.Environ) pipe.Environ { return e }, NewCmd(exec.Command("sh", "-c", `cat; ps -o pgid= -p $$`))),
+		)
+		require.NoError(t, err)
+		pgids := strings.Fields(out.String())
+		require.Len(t, pgids, 2)
+		require.Equal(t, pgids[0], pgids[1])
+		require.Equal(t, strconv.Itoa(job.Pgid()), pgids[0])
+	})
+}
+
+func TestSetsid(t *testing.T) {
+	t.Parallel()
+	var out strings.Builder
+	err := NewCmd(exec.Command("sh", "-c", `ps -o sid= -p $$; echo $$`)).
+		Setsid(true).
+		Run(context.Background(), NewStdio(nil, &out, nil))
+	require.NoError(t, err)
+	fields := strings.Fields(out.String())
+	require.Len(t, fields, 2)
+	require.Equal(t, fields[1], fields[0])
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrJobNotStarted is returned by Job.Signal before the first process of a
+// job starts
+var ErrJobNotStarted = errors.New("unix: job is not started")
+
+// Job is a process group shared by all Cmd filters of a Line, like a shell
+// job. The first started process is a group leader and the others join its
+// group, so a signal can be delivered to the whole pipeline at once.
+//
+//	job := unix.NewJob()
+//	go func() { err = unix.NewLine().Job(job).Run(ctx, stdio, filters...) }()
+//	job.Signal(syscall.SIGSTOP)
+//
+// Processes are started one by one and none is waited for until all of
+// them started, so the leader is not reaped before the others join. A Job
+// is used by one Line.Run at a time.
+type Job struct {
+	mu       sync.Mutex
+	pgid     int
+	expected int
+	arrived  int
+	all      chan struct{}
+}
+
+func NewJob() *Job {
+	return &Job{}
+}
+
+// Pgid returns an id of the process group or zero if no process started
+func (j *Job) Pgid() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pgid
+}
+
+// Signal sends sig to all processes of the job
+func (j *Job) Signal(sig os.Signal) error {
+	pgid := j.Pgid()
+	if pgid == 0 {
+		return ErrJobNotStarted
+	}
+	return signalGroup(pgid, sig)
+}
+
+// expect resets the job for a Line with n commands
+func (j *Job) expect(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pgid = 0
+	j.expected = n
+	j.arrived = 0
+	j.all = make(chan struct{})
+}
+
+// start starts a command in the job process group
+func (j *Job) start(cmd *exec.Cmd) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	setProcessGroup(cmd, j.pgid)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if j.pgid == 0 {
+		j.pgid = cmd.Process.Pid
+	}
+	return nil
+}
+
+// count counts a command which tried to start or which never will
+func (j *Job) count() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.arrived++
+	if j.arrived == j.expected {
+		close(j.all)
+	}
+}
+
+// wait blocks until all commands of the job are counted or ctx is done. A
+// stage pipe.Line skips after a failure never runs, but ctx is canceled
+// first.
+func (j *Job) wait(ctx context.Context) {
+	j.mu.Lock()
+	all := j.all
+	j.mu.Unlock()
+	select {
+	case <-all:
+	case <-ctx.Done():
+	}
+}
+
+// jobSlot is a place of one stage in a job, it is counted once, either
+// when the Cmd tried to start or when the stage returned without it
+type jobSlot struct {
+	job  *Job
+	once sync.Once
+}
+
+// arrive counts the stage and blocks until all commands of the job tried to
+// start or ctx is done
+func (s *jobSlot) arrive(ctx context.Context) {
+	s.once.Do(s.job.count)
+	s.job.wait(ctx)
+}
+
+// leave counts the stage if it did not arrive, so other commands do not wait
+// for a command which never starts
+func (s *jobSlot) leave() {
+	if s == nil {
+		return
+	}
+	s.once.Do(s.job.count)
+}
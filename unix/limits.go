@@ -0,0 +1,119 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+// IOClass is an I/O scheduling class of ionice
+type IOClass int
+
+const (
+	IONone IOClass = iota
+	IORealtime
+	IOBestEffort
+	IOIdle
+)
+
+// Limits are resource limits and priorities applied to a command before it
+// executes. Zero values mean no change.
+type Limits struct {
+	// CPU is a CPU time limit, rounded up to seconds
+	CPU time.Duration
+	// AddressSpace is a size of the virtual memory in bytes
+	AddressSpace uint64
+	// OpenFiles is a maximum number of open files
+	OpenFiles uint64
+	// FileSize is a maximum size of a file in bytes the command can write
+	FileSize uint64
+	// Processes is a maximum number of processes of the user
+	Processes uint64
+	// Nice is added to the scheduling priority
+	Nice int
+	// IOClass and IOLevel set the I/O priority like ionice -c class -n level
+	IOClass IOClass
+	IOLevel int
+}
+
+// Limit applies limits to the command. Go can't run a code between fork and
+// exec, so the command is started via a helper, which is the running binary
+// itself. It sets the limits and executes the command, so Init must be
+// called at the start of main. Run fails with code 1 otherwise. The helper
+// sets an umask of pipe.Environ too.
+func (c Cmd) Limit(limits Limits) Cmd {
+	c.limits = limits
+	return c
+}
+
+const limitsEnv = "GIO_UNIX_LIMITS"
+
+var initialized atomic.Bool
+
+// Init must be called at the start of main, or of TestMain, of programs
+// using Cmd.Limit. When the binary runs as a helper, Init applies the limits
+// and executes the command, so it never returns.
+//
+//	func main() {
+//		unix.Init()
+//		...
+//	}
+func Init() {
+	initialized.Store(true)
+	data, ok := os.LookupEnv(limitsEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(limitsEnv)
+	var spec limitsSpec
+	err := json.Unmarshal([]byte(data), &spec)
+	if err == nil {
+		err = spec.Limits.apply()
+	}
+	if err == nil && spec.Umask != nil {
+		err = setUmask(*spec.Umask)
+	}
+	if err == nil {
+		err = execve(spec.Path, spec.Args, os.Environ())
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", spec.Path, err)
+	os.Exit(pipe.NotExecutable)
+}
+
+// limitsSpec is passed to the helper via an environment variable
+type limitsSpec struct {
+	Path   string
+	Args   []string
+	Limits Limits
+	Umask  *os.FileMode
+}
+
+// wrap makes cmd to start the helper
+func (s limitsSpec) wrap(cmd *exec.Cmd) error {
+	if !initialized.Load() {
+		return errors.New("unix: Cmd.Limit requires unix.Init to be called from main")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	s.Path, s.Args = cmd.Path, cmd.Args
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(cmd.Environ(), limitsEnv+"="+string(data))
+	cmd.Path = exe
+	cmd.Args = []string{exe}
+	return nil
+}
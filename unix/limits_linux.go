@@ -0,0 +1,85 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+func (l Limits) apply() error {
+	if l.CPU > 0 {
+		secs := uint64((l.CPU + time.Second - 1) / time.Second)
+		// the soft limit sends SIGXCPU, the hard one SIGKILL
+		if err := setrlimit("cpu", syscall.RLIMIT_CPU, secs, secs+1); err != nil {
+			return err
+		}
+	}
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"address space", syscall.RLIMIT_AS, l.AddressSpace},
+		{"open files", syscall.RLIMIT_NOFILE, l.OpenFiles},
+		{"file size", syscall.RLIMIT_FSIZE, l.FileSize},
+		{"processes", rlimitNproc, l.Processes},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		if err := setrlimit(limit.name, limit.resource, limit.value, limit.value); err != nil {
+			return err
+		}
+	}
+	if l.Nice != 0 {
+		prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+		if err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+		// the raw syscall returns 20-nice
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, 20-prio+l.Nice); err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+	}
+	if l.IOClass != IONone {
+		prio := uintptr(l.IOClass)<<ioprioClassShift | uintptr(l.IOLevel)
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prio); errno != 0 {
+			return fmt.Errorf("ionice: %w", errno)
+		}
+	}
+	return nil
+}
+
+func setrlimit(name string, resource int, cur, max uint64) error {
+	var old syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &old); err != nil {
+		return fmt.Errorf("limit %s: %w", name, err)
+	}
+	// an unprivileged process can only lower the hard limit
+	max = min(max, old.Max)
+	cur = min(cur, max)
+	if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: cur, Max: max}); err != nil {
+		return fmt.Errorf("limit %s: %w", name, err)
+	}
+	return nil
+}
+
+func setUmask(mask os.FileMode) error {
+	syscall.Umask(int(mask))
+	return nil
+}
+
+func execve(path string, args []string, env []string) error {
+	return syscall.Exec(path, args, env)
+}
@@ -0,0 +1,10 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+
+package unix
+
+// rlimitNproc is RLIMIT_NPROC of mips, syscall does not define it
+const rlimitNproc = 8
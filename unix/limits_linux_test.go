@@ -0,0 +1,80 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestLimit(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		script string
+		limits Limits
+		out    string
+		code   int
+	}{
+		{
+			name:   "open files",
+			script: `ulimit -n`,
+			limits: Limits{OpenFiles: 42},
+			out:    "42",
+		},
+		{
+			name:   "nice",
+			script: `nice`,
+			limits: Limits{Nice: 5},
+			out:    "5",
+		},
+		{
+			name:   "file size",
+			script: `head -c 100000 /dev/zero > "$0"`,
+			limits: Limits{FileSize: 1024},
+			code:   FileSizeLimit,
+		},
+		{
+			name:   "cpu",
+			script: `while :; do :; done`,
+			limits: Limits{CPU: time.Second},
+			code:   CPULimit,
+		},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var out strings.Builder
+			cmd := NewCmd(exec.Command("sh", "-c", tt.script, t.TempDir()+"/out")).Limit(tt.limits)
+			err := cmd.Run(ctx, NewStdio(nil, &out, nil))
+			if tt.code == 0 {
+				require.NoError(t, err)
+				require.Equal(t, tt.out, strings.TrimSpace(out.String()))
+				return
+			}
+			var pipeErr pipe.Error
+			require.ErrorAs(t, err, &pipeErr)
+			require.Equal(t, tt.code, pipeErr.Code)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package unix
+
+import (
+	"errors"
+	"os"
+)
+
+var errLimits = errors.New("unix: limits are supported on linux only")
+
+func (l Limits) apply() error {
+	return errLimits
+}
+
+func setUmask(os.FileMode) error {
+	return errLimits
+}
+
+func execve(string, []string, []string) error {
+	return errLimits
+}
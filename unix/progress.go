@@ -0,0 +1,57 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+// Progress is a pass-through filter like pv. It counts bytes and reports
+// the amount, rate, progress bar and ETA to stderr periodically. See
+// pipe.Progress for details.
+type Progress struct {
+	pipe.Progress[byte]
+}
+
+func NewProgress() Progress {
+	return Progress{
+		Progress: pipe.NewProgress[byte]().Format(pipe.FormatBytes).Buffer(32 * 1024),
+	}
+}
+
+// Total sets an expected number of bytes, so progress bar and ETA can be computed
+func (p Progress) Total(total int64) Progress {
+	return Progress{Progress: p.Progress.Total(total)}
+}
+
+// Interval sets how often the progress is reported, a non-positive value
+// means the default of one second
+func (p Progress) Interval(d time.Duration) Progress {
+	return Progress{Progress: p.Progress.Interval(d)}
+}
+
+// Quiet true never reports progress, false always reports the progress even
+// if stderr is not a terminal
+func (p Progress) Quiet(b bool) Progress {
+	return Progress{Progress: p.Progress.Quiet(b)}
+}
+
+// Format sets how the byte counts are formatted, pipe.FormatBytes by default
+func (p Progress) Format(format func(int64) string) Progress {
+	return Progress{Progress: p.Progress.Format(format)}
+}
+
+// Buffer sets how many bytes are copied at once, 32KiB by default
+func (p Progress) Buffer(n int) Progress {
+	return Progress{Progress: p.Progress.Buffer(n)}
+}
+
+func (p Progress) Run(ctx context.Context, stdio StandardIO) error {
+	pipeio := pipe.NewStdio[byte](stdio.Stdin(), stdio.Stdout(), stdio.Stderr())
+	return p.Progress.Run(ctx, pipeio)
+}
@@ -0,0 +1,50 @@
+package unix_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	cat := Cat{cat: []byte("three\nsmall\npigs\n")}
+
+	var stdout, stderr strings.Builder
+	stdio := NewStdio(nil, &stdout, &stderr)
+
+	pv := NewProgress().Total(17).Interval(time.Hour).Quiet(false)
+	err := NewLine().Run(ctx, stdio, cat, pv, CountLines{})
+	require.NoError(t, err)
+	require.Equal(t, "3\n", stdout.String())
+	require.True(t, strings.HasPrefix(stderr.String(), "\r17B "), stderr.String())
+	require.True(t, strings.HasSuffix(stderr.String(), "100%\n"))
+
+	// Buffer and Format keep unix.Progress, so it runs with unix stdio
+	stdout.Reset()
+	stderr.Reset()
+	pv = NewProgress().Buffer(4).Format(pipe.FormatBytes).Quiet(false)
+	err = NewLine().Run(ctx, stdio, cat, pv, CountLines{})
+	require.NoError(t, err)
+	require.Equal(t, "3\n", stdout.String())
+	require.True(t, strings.HasPrefix(stderr.String(), "\r17B "), stderr.String())
+}
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	cat := Cat{cat: []byte("three\nsmall\npigs\n")}
+
+	var stdout strings.Builder
+	stdio := NewStdio(nil, &stdout, nil)
+
+	throttle := NewThrottle(pipe.NewLimiter(math.Inf(1), 4))
+	err := NewLine().Run(ctx, stdio, cat, throttle, CountLines{})
+	require.NoError(t, err)
+	require.Equal(t, "3\n", stdout.String())
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Pty configures a pseudo-terminal of a command
+type Pty struct {
+	// Rows and Cols are a window size, zero keeps a kernel default
+	Rows uint16
+	Cols uint16
+	// Raw disables a line discipline. Without it a terminal echoes the
+	// input and translates \n to \r\n on the output, like an interactive
+	// terminal does.
+	Raw bool
+}
+
+// Pty runs the command attached to a pseudo-terminal, so tools which check
+// if stdout is a TTY behave like in an interactive shell. Stdin is copied
+// to the terminal and the terminal output to stdout, stderr stays a pipe.
+// The command runs in a new session with the terminal as a controlling one,
+// so it can't be used with a Job. Supported on linux only.
+func (c Cmd) Pty(pty Pty) Cmd {
+	c.pty = &pty
+	return c
+}
+
+// eot is VEOF, which ends the input of a terminal in a canonical mode
+const eot = 0x04
+
+// terminal connects stdin and stdout of a command to a pseudo-terminal
+type terminal struct {
+	master *os.File
+	slave  *os.File
+	raw    bool
+	in     io.Reader
+	out    io.Writer
+	done   chan struct{}
+	input  chan struct{}
+	err    error
+}
+
+// attach replaces stdin and stdout of cmd by the terminal
+func (t *terminal) attach(cmd *exec.Cmd) {
+	t.in, t.out = cmd.Stdin, cmd.Stdout
+	cmd.Stdin, cmd.Stdout = t.slave, t.slave
+	setControllingTerminal(cmd)
+}
+
+// start copies data once the command started
+func (t *terminal) start() {
+	t.slave.Close()
+	t.done = make(chan struct{})
+	t.input = make(chan struct{})
+	go func() {
+		defer close(t.input)
+		t.copyInput()
+	}()
+	go func() {
+		defer close(t.done)
+		t.err = t.output()
+	}()
+}
+
+// copyInput copies stdin to the terminal and ends the input in a canonical
+// mode
+func (t *terminal) copyInput() {
+	w := &lastByteWriter{w: t.master, last: '\n'}
+	if t.in != nil {
+		if _, err := io.Copy(w, t.in); err != nil {
+			return
+		}
+	}
+	if t.raw {
+		return
+	}
+	// EOT after a partial line only passes the line to a reader, so the
+	// second one is needed to end the input
+	if w.last != '\n' {
+		t.master.Write([]byte{eot})
+	}
+	t.master.Write([]byte{eot})
+}
+
+// lastByteWriter remembers the last written byte
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (w *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.last = p[n-1]
+	}
+	return n, err
+}
+
+// output copies the terminal output until all its users exit, so the
+// terminal hangup is a normal EOF for downstream filters
+func (t *terminal) output() error {
+	out := t.out
+	if out == nil {
+		out = io.Discard
+	}
+	_, err := io.Copy(out, t.master)
+	if isHangup(err) {
+		return nil
+	}
+	return err
+}
+
+// wait waits for the output, closes the terminal and stops the input copy
+func (t *terminal) wait() error {
+	<-t.done
+	t.master.Close()
+	t.stopInput()
+	return t.err
+}
+
+// stopInput waits until the input copy ends, so it does not read stdin after
+// Run returns. A file which supports deadlines is interrupted, a regular file
+// never blocks. Other readers can't be interrupted, so the copy is detached
+// and it ends on the next write to the closed terminal.
+func (t *terminal) stopInput() {
+	f, ok := t.in.(*os.File)
+	if t.in != nil && !ok {
+		return
+	}
+	if ok {
+		if err := f.SetReadDeadline(time.Now()); err == nil {
+			defer f.SetReadDeadline(time.Time{})
+		} else if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+			return
+		}
+	}
+	<-t.input
+}
+
+func (t *terminal) close() {
+	t.master.Close()
+	t.slave.Close()
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+func openTerminal(pty Pty) (*terminal, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	slave, err := openSlave(master, pty)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("pty: %w", err)
+	}
+	return &terminal{master: master, slave: slave, raw: pty.Raw}, nil
+}
+
+func openSlave(master *os.File, pty Pty) (*os.File, error) {
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		return nil, err
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		return nil, err
+	}
+	if pty.Rows != 0 || pty.Cols != 0 {
+		ws := struct{ rows, cols, x, y uint16 }{rows: pty.Rows, cols: pty.Cols}
+		if err := ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+			return nil, err
+		}
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pty.Raw {
+		if err := makeRaw(slave); err != nil {
+			slave.Close()
+			return nil, err
+		}
+	}
+	return slave, nil
+}
+
+// makeRaw is cfmakeraw(3)
+func makeRaw(f *os.File) error {
+	var t syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&t)); err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	return ioctl(f, syscall.TCSETS, unsafe.Pointer(&t))
+}
+
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setControllingTerminal makes stdin of cmd its controlling terminal
+func setControllingTerminal(cmd *exec.Cmd) {
+	attr := sysProcAttr(cmd)
+	attr.Setsid = true
+	attr.Setctty = true
+	attr.Ctty = 0
+}
+
+// isHangup returns true for an error reading a master of a terminal
+// without a slave
+func isHangup(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gomoni/gio/unix"
+)
+
+func TestPty(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		script string
+		pty    Pty
+		stdin  string
+		out    string
+	}{
+		{
+			name:   "tty",
+			script: `test -t 0 && test -t 1 && echo tty`,
+			out:    "tty\r\n",
+		},
+		{
+			name:   "raw",
+			script: `printf 'a\nb\n'`,
+			pty:    Pty{Raw: true},
+			out:    "a\nb\n",
+		},
+		{
+			name:   "winsize",
+			script: `stty size`,
+			pty:    Pty{Rows: 42, Cols: 120, Raw: true},
+			out:    "42 120\n",
+		},
+		{
+			name:   "input",
+			script: `head -n 1`,
+			pty:    Pty{Raw: true},
+			stdin:  "hello\nworld\n",
+			out:    "hello\n",
+		},
+		{
+			name:   "partial line",
+			script: `cat >/dev/null; echo done`,
+			stdin:  "hello",
+			out:    "hellodone\r\n",
+		},
+		{
+			name:   "echo",
+			script: `cat >/dev/null; echo done`,
+			stdin:  "hello\n",
+			out:    "hello\r\ndone\r\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var out strings.Builder
+			cmd := NewCmd(exec.Command("sh", "-c", tt.script)).Pty(tt.pty)
+			err := NewLine().Run(ctx, NewStdio(strings.NewReader(tt.stdin), &out, nil), cmd, NewCmd(exec.Command("cat")))
+			require.NoError(t, err)
+			require.Equal(t, tt.out, out.String())
+		})
+	}
+}
+
+func TestPtyStdin(t *testing.T) {
+	t.Parallel()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	// the command does not read stdin, so the copy is stopped when it exits
+	var out strings.Builder
+	cmd := NewCmd(exec.Command("sh", "-c", `echo done`)).Pty(Pty{Raw: true})
+	err = cmd.Run(context.Background(), NewStdio(r, &out, nil))
+	require.NoError(t, err)
+	require.Equal(t, "done\n", out.String())
+
+	_, err = w.WriteString("later\n")
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "later\n", string(buf[:n]))
+}
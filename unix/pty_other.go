@@ -0,0 +1,22 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package unix
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func openTerminal(Pty) (*terminal, error) {
+	return nil, errors.New("unix: pty is supported on linux only")
+}
+
+func setControllingTerminal(*exec.Cmd) {}
+
+func isHangup(error) bool {
+	return false
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+type redirectOp int
+
+const (
+	opRead redirectOp = iota
+	opWrite
+	opAppend
+	opDup
+	opText
+)
+
+// Redirection overrides a standard stream of a filter like a shell
+// redirection does. Redirections are applied from left to right, so
+// ToFile(f), StderrToStdout() sends both streams to f, while
+// StderrToStdout(), ToFile(f) sends stderr to the original stdout.
+type Redirection struct {
+	fd   int
+	op   redirectOp
+	path string
+	text string
+}
+
+// FromFile is < path
+func FromFile(path string) Redirection {
+	return Redirection{fd: 0, op: opRead, path: path}
+}
+
+// ToFile is > path
+func ToFile(path string) Redirection {
+	return Redirection{fd: 1, op: opWrite, path: path}
+}
+
+// AppendFile is >> path
+func AppendFile(path string) Redirection {
+	return Redirection{fd: 1, op: opAppend, path: path}
+}
+
+// StderrToFile is 2> path
+func StderrToFile(path string) Redirection {
+	return Redirection{fd: 2, op: opWrite, path: path}
+}
+
+// StderrToStdout is 2>&1
+func StderrToStdout() Redirection {
+	return Redirection{fd: 2, op: opDup}
+}
+
+// BothToFile is &> path
+func BothToFile(path string) Redirection {
+	return Redirection{fd: -1, op: opWrite, path: path}
+}
+
+// HereDoc reads stdin from text as is, like a here document
+func HereDoc(text string) Redirection {
+	return Redirection{fd: 0, op: opText, text: text}
+}
+
+// HereString is <<< s, which adds a newline to s
+func HereString(s string) Redirection {
+	return Redirection{fd: 0, op: opText, text: s + "\n"}
+}
+
+// FromNull is < /dev/null
+func FromNull() Redirection {
+	return FromFile(os.DevNull)
+}
+
+// ToNull is > /dev/null
+func ToNull() Redirection {
+	return ToFile(os.DevNull)
+}
+
+// StderrToNull is 2> /dev/null
+func StderrToNull() Redirection {
+	return StderrToFile(os.DevNull)
+}
+
+// String renders the redirection like a shell does
+func (r Redirection) String() string {
+	fd := ""
+	switch r.fd {
+	case -1:
+		fd = "&"
+	case 2:
+		fd = "2"
+	}
+	switch r.op {
+	case opRead:
+		return "< " + r.path
+	case opWrite:
+		return fd + "> " + r.path
+	case opAppend:
+		return fd + ">> " + r.path
+	case opDup:
+		return fd + ">&1"
+	case opText:
+		return "<<< " + strconv.Quote(strings.TrimSuffix(r.text, "\n"))
+	}
+	return ""
+}
+
+// Redirect returns a filter with standard streams overridden by
+// redirections. Files are opened before the filter runs and closed when it
+// returns. A file which can't be opened fails the stage with code 1.
+// Relative paths and permissions of created files follow pipe.Environ of
+// stdio. The redirected streams are *os.File, so Cmd uses them directly.
+//
+//	unix.Redirect(grep, unix.FromFile("in.txt"), unix.StderrToNull())
+func Redirect(filter Filter, redirections ...Redirection) Filter {
+	return redirected{filter: filter, redirections: redirections}
+}
+
+type redirected struct {
+	filter       Filter
+	redirections []Redirection
+}
+
+// Name returns a name of the filter with redirections, so grep foo < in.txt
+func (r redirected) Name() string {
+	parts := make([]string, 0, len(r.redirections)+1)
+	parts = append(parts, pipe.FilterName(r.filter))
+	for _, redir := range r.redirections {
+		parts = append(parts, redir.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (r redirected) Unwrap() any {
+	return r.filter
+}
+
+func (r redirected) Run(ctx context.Context, stdio StandardIO) error {
+	environ := EnvironOf(stdio)
+	stdin, stdout, stderr := stdio.Stdin(), stdio.Stdout(), stdio.Stderr()
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, redir := range r.redirections {
+		switch redir.op {
+		case opRead:
+			f, err := os.Open(environ.Path(redir.path))
+			if err != nil {
+				return pipe.NewError(1, err)
+			}
+			files = append(files, f)
+			stdin = f
+			continue
+		case opText:
+			stdin = strings.NewReader(redir.text)
+			continue
+		case opDup:
+			stderr = stdout
+			continue
+		}
+
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if redir.op == opAppend {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := createFile(environ, redir.path, flag)
+		if err != nil {
+			return pipe.NewError(1, err)
+		}
+		files = append(files, f)
+		switch redir.fd {
+		case 1:
+			stdout = f
+		case 2:
+			stderr = f
+		default:
+			stdout, stderr = f, f
+		}
+	}
+	return r.filter.Run(ctx, derive(stdio, stdin, stdout, stderr))
+}
+
+// createFile opens a file for writing. A file created with an umask of
+// environ gets 0666 without the mask regardless of the process umask.
+func createFile(environ pipe.Environ, path string, flag int) (*os.File, error) {
+	path = environ.Path(path)
+	mask, ok := environ.Umask()
+	if !ok {
+		return os.OpenFile(path, flag, 0o666)
+	}
+	f, err := os.OpenFile(path, flag|os.O_EXCL, 0o666)
+	if errors.Is(err, fs.ErrExist) {
+		return os.OpenFile(path, flag&^os.O_CREATE, 0)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0o666 &^ mask); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+func TestRedirect(t *testing.T) {
+	t.Parallel()
+	const script = `cat; echo out; echo err >&2`
+	testCases := []struct {
+		name         string
+		redirections func(dir string) []Redirection
+		describe     string
+		stdout       string
+		stderr       string
+		file         string
+	}{
+		{
+			name: "to file",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{ToFile(filepath.Join(dir, "f"))}
+			},
+			describe: "> f",
+			stderr:   "err\n",
+			file:     "out\n",
+		},
+		{
+			name: "append",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{AppendFile(filepath.Join(dir, "f"))}
+			},
+			describe: ">> f",
+			stderr:   "err\n",
+			file:     "old\nout\n",
+		},
+		{
+			name: "stderr to file",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{StderrToFile(filepath.Join(dir, "f"))}
+			},
+			describe: "2> f",
+			stdout:   "out\n",
+			file:     "err\n",
+		},
+		{
+			name: "both to file",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{BothToFile(filepath.Join(dir, "f"))}
+			},
+			describe: "&> f",
+			file:     "out\nerr\n",
+		},
+		{
+			name: "to file stderr to stdout",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{ToFile(filepath.Join(dir, "f")), StderrToStdout()}
+			},
+			describe: "> f 2>&1",
+			file:     "out\nerr\n",
+		},
+		{
+			name: "stderr to stdout to file",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{StderrToStdout(), ToFile(filepath.Join(dir, "f"))}
+			},
+			describe: "2>&1 > f",
+			stdout:   "err\n",
+			file:     "out\n",
+		},
+		{
+			name: "from file",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{FromFile(filepath.Join(dir, "f")), StderrToNull()}
+			},
+			describe: "< f 2> /dev/null",
+			stdout:   "old\nout\n",
+			file:     "old\n",
+		},
+		{
+			name: "here string",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{HereString("hello"), ToNull()}
+			},
+			describe: `<<< "hello" > /dev/null`,
+			stderr:   "err\n",
+			file:     "old\n",
+		},
+		{
+			name: "here doc",
+			redirections: func(dir string) []Redirection {
+				return []Redirection{HereDoc("a\nb\n"), StderrToNull()}
+			},
+			describe: `<<< "a\nb" 2> /dev/null`,
+			stdout:   "a\nb\nout\n",
+			file:     "old\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			f := filepath.Join(dir, "f")
+			if tt.name != "to file" {
+				require.NoError(t, os.WriteFile(f, []byte("old\n"), 0o644))
+			}
+			filter := Redirect(NewCmd(exec.Command("sh", "-c", script)), tt.redirections(dir)...)
+			require.Equal(t, "sh -c "+script+" "+tt.describe, strings.ReplaceAll(pipe.FilterName(filter), dir+"/", ""))
+
+			var stdout, stderr strings.Builder
+			err := filter.Run(context.Background(), NewStdio(strings.NewReader(""), &stdout, &stderr))
+			require.NoError(t, err)
+			require.Equal(t, tt.stdout, stdout.String())
+			require.Equal(t, tt.stderr, stderr.String())
+			data, err := os.ReadFile(f)
+			require.NoError(t, err)
+			require.Equal(t, tt.file, string(data))
+		})
+	}
+}
+
+func TestRedirectError(t *testing.T) {
+	t.Parallel()
+	var out strings.Builder
+	err := NewLine().Run(
+		context.Background(),
+		NewStdio(nil, &out, nil),
+		Cat{cat: []byte("a\nb\n")},
+		Redirect(CountLines{}, FromFile(filepath.Join(t.TempDir(), "missing"))),
+	)
+	var pipeErr pipe.Error
+	require.ErrorAs(t, err, &pipeErr)
+	require.Equal(t, 1, pipeErr.Code)
+	require.ErrorContains(t, err, "no such file or directory")
+
+	out.Reset()
+	err = NewLine().Run(
+		context.Background(),
+		NewStdio(nil, &out, nil),
+		Redirect(CountLines{}, HereString("a\nb")),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "2\n", out.String())
+}
+
+func TestRedirectUmask(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	require.NoError(t, os.WriteFile(existing, []byte("old\n"), 0o600))
+
+	// a loose umask is not restricted by the umask of the process
+	stdio := NewStdio(nil, nil, nil).WithEnviron(pipe.Environ{}.Chdir(dir).WithUmask(0))
+	for _, redir := range []Redirection{ToFile("created"), ToFile("existing"), AppendFile("appended")} {
+		err := Redirect(Cat{cat: []byte("new\n")}, redir).Run(context.Background(), stdio)
+		require.NoError(t, err)
+	}
+	for name, perm := range map[string]os.FileMode{"created": 0o666, "existing": 0o600, "appended": 0o666} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, perm, info.Mode().Perm(), name)
+	}
+	data, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	require.Equal(t, "new\n", string(data))
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+// stream is an additional input or output stream of Stdio
+type stream struct {
+	r io.Reader
+	w io.Writer
+}
+
+// WithInput returns a copy of stdio with an additional input stream fd
+func (s Stdio) WithInput(fd int, r io.Reader) Stdio {
+	return s.with(fd, stream{r: r})
+}
+
+// WithOutput returns a copy of stdio with an additional output stream fd,
+// so filters can emit side outputs like cmd 3>rejects.log does. Cmd gets
+// the stream as a file descriptor fd. Stages of a Line share the streams,
+// so the writer must be safe for a concurrent use.
+func (s Stdio) WithOutput(fd int, w io.Writer) Stdio {
+	return s.with(fd, stream{w: w})
+}
+
+func (s Stdio) with(fd int, st stream) Stdio {
+	extra := make(map[int]stream, len(s.extra)+1)
+	for k, v := range s.extra {
+		extra[k] = v
+	}
+	extra[fd] = st
+	s.extra = extra
+	return s
+}
+
+func streamsOf(stdio StandardIO) map[int]stream {
+	if s, ok := stdio.(Stdio); ok {
+		return s.extra
+	}
+	return nil
+}
+
+// Input returns an additional input stream fd
+func Input(stdio StandardIO, fd int) (io.Reader, bool) {
+	st, ok := streamsOf(stdio)[fd]
+	return st.r, ok && st.r != nil
+}
+
+// Output returns an additional output stream fd
+func Output(stdio StandardIO, fd int) (io.Writer, bool) {
+	st, ok := streamsOf(stdio)[fd]
+	return st.w, ok && st.w != nil
+}
+
+// Fds returns sorted numbers of additional streams of stdio
+func Fds(stdio StandardIO) []int {
+	extra := streamsOf(stdio)
+	fds := make([]int, 0, len(extra))
+	for fd := range extra {
+		fds = append(fds, fd)
+	}
+	slices.Sort(fds)
+	return fds
+}
+
+// derive returns Stdio with new standard streams, which inherits additional
+// streams and the environment of stdio
+func derive(stdio StandardIO, stdin io.Reader, stdout, stderr io.Writer) Stdio {
+	ret := NewStdio(stdin, stdout, stderr)
+	ret.extra = streamsOf(stdio)
+	ret.env = EnvironOf(stdio)
+	return ret
+}
+
+// toPipe converts stdio to pipe.Stdio
+func toPipe(stdio StandardIO) pipe.Stdio[byte] {
+	ret := pipe.NewStdio[byte](stdio.Stdin(), stdio.Stdout(), stdio.Stderr()).WithEnviron(EnvironOf(stdio))
+	for fd, st := range streamsOf(stdio) {
+		if st.r != nil {
+			ret = pipe.WithInput[byte, byte](ret, fd, st.r)
+		} else {
+			ret = pipe.WithOutput[byte, byte](ret, fd, st.w)
+		}
+	}
+	return ret
+}
+
+// fromPipe converts pipe.StandardIO to Stdio
+func fromPipe(stdio pipe.StandardIO[byte]) Stdio {
+	ret := NewStdio(stdio.Stdin(), stdio.Stdout(), stdio.Stderr()).WithEnviron(pipe.EnvironOf(stdio))
+	for _, fd := range pipe.Fds[byte](stdio) {
+		if r, ok := pipe.Input[byte](stdio, fd); ok {
+			ret = ret.WithInput(fd, r)
+		} else if w, ok := pipe.Output[byte](stdio, fd); ok {
+			ret = ret.WithOutput(fd, w)
+		}
+	}
+	return ret
+}
+
+// extraFiles maps additional streams of stdio to exec.Cmd.ExtraFiles, where
+// index 0 is fd 3. A stream which is not *os.File is copied via os.Pipe.
+type extraFiles struct {
+	files []*os.File
+	// child ends of os.Pipe closed once the command starts
+	child []*os.File
+	// parent ends of os.Pipe
+	parent  []*os.File
+	copies  []func()
+	outputs sync.WaitGroup
+	mu      sync.Mutex
+	err     error
+	// errors of input copies are ignored after wait
+	stopped bool
+}
+
+func newExtraFiles(stdio StandardIO, files []*os.File) (*extraFiles, error) {
+	e := &extraFiles{files: slices.Clone(files)}
+	for fd, st := range streamsOf(stdio) {
+		if fd < 3 {
+			continue
+		}
+		for len(e.files) <= fd-3 {
+			e.files = append(e.files, nil)
+		}
+		if err := e.add(fd, st); err != nil {
+			e.close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *extraFiles) add(fd int, st stream) error {
+	if f, ok := st.r.(*os.File); ok {
+		e.files[fd-3] = f
+		return nil
+	}
+	if f, ok := st.w.(*os.File); ok {
+		e.files[fd-3] = f
+		return nil
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	if st.r != nil {
+		e.files[fd-3] = pr
+		e.child = append(e.child, pr)
+		e.parent = append(e.parent, pw)
+		e.copies = append(e.copies, func() {
+			_, err := io.Copy(pw, st.r)
+			if errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) {
+				// the command does not read all the input
+				err = nil
+			}
+			// the error is set before the command can see EOF
+			e.setErr(err, true)
+			pw.Close()
+		})
+		return nil
+	}
+	e.files[fd-3] = pw
+	e.child = append(e.child, pw)
+	e.parent = append(e.parent, pr)
+	e.outputs.Add(1)
+	e.copies = append(e.copies, func() {
+		defer e.outputs.Done()
+		_, err := io.Copy(st.w, pr)
+		pr.Close()
+		e.setErr(err, false)
+	})
+	return nil
+}
+
+// start closes the child ends and copies the streams
+func (e *extraFiles) start() {
+	for _, f := range e.child {
+		f.Close()
+	}
+	for _, copy := range e.copies {
+		go copy()
+	}
+}
+
+// setErr keeps the first error, errors of input copies after wait are
+// ignored
+func (e *extraFiles) setErr(err error, input bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil || e.err != nil || (input && e.stopped) {
+		return
+	}
+	e.err = err
+}
+
+// wait waits until output streams are copied and stops copying of the
+// input streams. An input copy still blocked on a read of its stream is
+// detached, it ends on the next write to the closed pipe.
+func (e *extraFiles) wait() error {
+	e.outputs.Wait()
+	e.mu.Lock()
+	e.stopped = true
+	err := e.err
+	e.mu.Unlock()
+	for _, f := range e.parent {
+		f.Close()
+	}
+	return err
+}
+
+func (e *extraFiles) close() {
+	for _, f := range e.child {
+		f.Close()
+	}
+	for _, f := range e.parent {
+		f.Close()
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+// Side writes a line to stdout and the stream 3
+type Side struct{}
+
+func (Side) Run(ctx context.Context, stdio StandardIO) error {
+	side, ok := Output(stdio, 3)
+	if !ok {
+		return errors.New("no stream 3")
+	}
+	fmt.Fprintln(side, "native side")
+	_, err := fmt.Fprintln(stdio.Stdout(), "native")
+	return err
+}
+
+func TestStreams(t *testing.T) {
+	t.Parallel()
+	var out, side strings.Builder
+	stdio := NewStdio(strings.NewReader(""), &out, nil).
+		WithOutput(3, &side).
+		WithInput(4, strings.NewReader("input\n"))
+	require.Equal(t, []int{3, 4}, Fds(stdio))
+
+	err := NewLine().Run(
+		context.Background(),
+		stdio,
+		Side{},
+		NewCmd(exec.Command("sh", "-c", `cat; cat <&4; echo cmd side >&3`)),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "native\ninput\n", out.String())
+	require.Equal(t, "native side\ncmd side\n", side.String())
+}
+
+func TestStreamsFile(t *testing.T) {
+	t.Parallel()
+	f, err := os.Create(filepath.Join(t.TempDir(), "side"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var out strings.Builder
+	stdio := NewStdio(strings.NewReader(""), &out, nil).WithOutput(3, f)
+	cmd := Redirect(NewCmd(exec.Command("sh", "-c", `echo out; echo side >&3`)), StderrToNull())
+	err = cmd.Run(context.Background(), stdio)
+	require.NoError(t, err)
+	require.Equal(t, "out\n", out.String())
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, "side\n", string(data))
+}
+
+// failReader returns data and then an error instead of io.EOF
+type failReader struct {
+	data string
+	err  error
+}
+
+func (r *failReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreamsInput(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// the command exits without reading the whole input
+	big := strings.Repeat("x", 1<<20)
+	for i := 0; i < 20; i++ {
+		stdio := NewStdio(strings.NewReader(""), nil, nil).WithInput(3, strings.NewReader(big))
+		err := NewCmd(exec.Command("sh", "-c", `head -c 1 <&3 >/dev/null`)).Run(ctx, stdio)
+		require.NoError(t, err)
+	}
+
+	// a read error of the stream is returned
+	boom := errors.New("boom")
+	var out strings.Builder
+	stdio := NewStdio(strings.NewReader(""), &out, nil).WithInput(3, &failReader{data: "input\n", err: boom})
+	err := NewCmd(exec.Command("sh", "-c", `cat <&3`)).Run(ctx, stdio)
+	var pipeErr pipe.Error
+	require.ErrorAs(t, err, &pipeErr)
+	require.ErrorIs(t, pipeErr.Err, boom)
+	require.Equal(t, "input\n", out.String())
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Subst is a process substitution, a pipeline running in the background
+// whose input or output is passed to a command as a file argument.
+//
+//	diff := unix.NewCmd(exec.Command("diff", "a", "b")).
+//		Subst(1, unix.ProcIn(sortA)).
+//		Subst(2, unix.ProcIn(sortB))
+//
+// runs diff <(sort a) <(sort b). Like in a shell, an exit status of the
+// pipeline is ignored.
+type Subst struct {
+	line    Line
+	filters []Filter
+	output  bool
+	stdout  io.Writer
+}
+
+// ProcIn is <(filters), the command reads an output of filters
+func ProcIn(filters ...Filter) Subst {
+	return Subst{line: NewLine(), filters: filters}
+}
+
+// ProcOut is >(filters), filters read what the command writes. The output
+// of filters is discarded unless Stdout is set.
+func ProcOut(filters ...Filter) Subst {
+	return Subst{line: NewLine(), filters: filters, output: true}
+}
+
+// Line sets a Line running the filters
+func (s Subst) Line(line Line) Subst {
+	s.line = line
+	return s
+}
+
+// Stdout sets where an output of ProcOut filters goes
+func (s Subst) Stdout(w io.Writer) Subst {
+	s.stdout = w
+	return s
+}
+
+// String renders the substitution like a shell does, so <(sort a)
+func (s Subst) String() string {
+	op := "<("
+	if s.output {
+		op = ">("
+	}
+	return op + Describe(s.filters...) + ")"
+}
+
+type substArg struct {
+	arg   int
+	subst Subst
+}
+
+// Subst replaces an argument arg of the command by a path of the process
+// substitution, which is /dev/fd/N of an extra file descriptor.
+func (c Cmd) Subst(arg int, subst Subst) Cmd {
+	c.substs = append(slices.Clip(c.substs), substArg{arg: arg, subst: subst})
+	return c
+}
+
+// substitutions runs process substitutions of one Cmd.Run
+type substitutions struct {
+	substs []Subst
+	// child ends of os.Pipe closed once the command starts
+	child []*os.File
+	// parent ends of os.Pipe
+	parent []*os.File
+	wg     sync.WaitGroup
+}
+
+// substitute connects the substitutions to cmd by os.Pipe
+func (c Cmd) substitute(cmd *exec.Cmd) (*substitutions, error) {
+	if len(c.substs) == 0 {
+		return nil, nil
+	}
+	s := &substitutions{}
+	for _, sa := range c.substs {
+		if sa.arg <= 0 || sa.arg >= len(cmd.Args) {
+			s.close()
+			return nil, fmt.Errorf("substitution %s: argument %d out of range", sa.subst, sa.arg)
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		child, parent := pr, pw
+		if sa.subst.output {
+			child, parent = pw, pr
+		}
+		s.substs = append(s.substs, sa.subst)
+		s.child = append(s.child, child)
+		s.parent = append(s.parent, parent)
+		cmd.Args[sa.arg] = fmt.Sprintf("/dev/fd/%d", 3+len(cmd.ExtraFiles))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, child)
+	}
+	return s, nil
+}
+
+// start closes the child ends and runs the pipelines
+func (s *substitutions) start(ctx context.Context, stdio StandardIO) {
+	if s == nil {
+		return
+	}
+	for _, f := range s.child {
+		f.Close()
+	}
+	for idx, subst := range s.substs {
+		subst, f := subst, s.parent[idx]
+		stdin, stdout := io.Reader(strings.NewReader("")), io.Writer(f)
+		if subst.output {
+			stdin, stdout = f, io.Discard
+			if subst.stdout != nil {
+				stdout = subst.stdout
+			}
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer f.Close()
+			subst.line.Run(ctx, derive(stdio, stdin, stdout, stdio.Stderr()), subst.filters...)
+		}()
+	}
+}
+
+// wait waits until all pipelines exit
+func (s *substitutions) wait() {
+	if s == nil {
+		return
+	}
+	s.wg.Wait()
+}
+
+func (s *substitutions) close() {
+	if s == nil {
+		return
+	}
+	for _, f := range s.child {
+		f.Close()
+	}
+	for _, f := range s.parent {
+		f.Close()
+	}
+}
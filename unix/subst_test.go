@@ -0,0 +1,58 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix_test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomoni/gio/pipe"
+	. "github.com/gomoni/gio/unix"
+)
+
+func TestSubst(t *testing.T) {
+	t.Parallel()
+	t.Run("in", func(t *testing.T) {
+		t.Parallel()
+		sortA := NewCmd(exec.Command("sort"))
+		cmd := NewCmd(exec.Command("diff", "a", "b")).
+			Subst(1, ProcIn(Cat{cat: []byte("b\na\n")}, sortA)).
+			Subst(2, ProcIn(Cat{cat: []byte("a\nc\n")}))
+		require.Equal(t, "diff <(Cat | sort) <(Cat)", pipe.FilterName(cmd))
+
+		var out strings.Builder
+		err := cmd.Run(context.Background(), NewStdio(nil, &out, nil))
+		var pipeErr pipe.Error
+		require.ErrorAs(t, err, &pipeErr)
+		require.Equal(t, 1, pipeErr.Code)
+		require.Equal(t, "2c2\n< b\n---\n> c\n", out.String())
+	})
+
+	t.Run("out", func(t *testing.T) {
+		t.Parallel()
+		var out, sub strings.Builder
+		cmd := NewCmd(exec.Command("tee", "f")).
+			Subst(1, ProcOut(CountLines{}).Stdout(&sub))
+		require.Equal(t, "tee >(CountLines)", pipe.FilterName(cmd))
+
+		err := NewLine().Run(context.Background(), NewStdio(strings.NewReader("a\nb\nc\n"), &out, nil), cmd)
+		require.NoError(t, err)
+		require.Equal(t, "a\nb\nc\n", out.String())
+		require.Equal(t, "3\n", sub.String())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewCmd(exec.Command("cat")).Subst(1, ProcIn(Cat{}))
+		err := cmd.Run(context.Background(), NewStdio(nil, nil, nil))
+		var pipeErr pipe.Error
+		require.ErrorAs(t, err, &pipeErr)
+		require.Equal(t, 1, pipeErr.Code)
+	})
+}
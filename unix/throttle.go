@@ -0,0 +1,37 @@
+// Copyright 2023 Michal Vyskocil. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"context"
+
+	"github.com/gomoni/gio/pipe"
+)
+
+// Throttle is a pass-through filter limiting the byte rate by a
+// pipe.Limiter, where rate is in bytes per second and burst in bytes.
+//
+//	unix.NewThrottle(pipe.NewLimiter(1024*1024, 64*1024))
+//
+// See pipe.Throttle for details.
+type Throttle struct {
+	pipe.Throttle[byte]
+}
+
+func NewThrottle(limiter *pipe.Limiter) Throttle {
+	return Throttle{
+		Throttle: pipe.NewThrottle[byte](limiter).Buffer(32 * 1024),
+	}
+}
+
+// Buffer sets how many bytes are read at once
+func (t Throttle) Buffer(n int) Throttle {
+	return Throttle{Throttle: t.Throttle.Buffer(n)}
+}
+
+func (t Throttle) Run(ctx context.Context, stdio StandardIO) error {
+	pipeio := pipe.NewStdio[byte](stdio.Stdin(), stdio.Stdout(), stdio.Stderr())
+	return t.Throttle.Run(ctx, pipeio)
+}
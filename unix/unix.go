@@ -13,6 +13,8 @@ package unix
 import (
 	"context"
 	"io"
+	"os"
+	"slices"
 
 	"github.com/gomoni/gio"
 	"github.com/gomoni/gio/pipe"
@@ -32,6 +34,8 @@ type Stdio struct {
 	stdin  gio.Reader[byte]
 	stdout gio.Writer[byte]
 	stderr gio.Writer[byte]
+	extra  map[int]stream
+	env    pipe.Environ
 }
 
 func NewStdio(stdin io.Reader, stdout io.Writer, stderr io.Writer) Stdio {
@@ -56,6 +60,7 @@ func (s Stdio) Stderr() io.Writer {
 
 type Line struct {
 	pipe.Line[byte]
+	job *Job
 }
 
 func NewLine() Line {
@@ -63,24 +68,170 @@ func NewLine() Line {
 }
 
 func (p Line) Pipefail(b bool) Line {
-	return Line{Line: p.Line.Pipefail(b)}
+	p.Line = p.Line.Pipefail(b)
+	return p
 }
 
+// Observe adds observers, see pipe.Line.Observe. A Metrics observer is
+// available as pipe.NewMetrics.
+func (p Line) Observe(observers ...pipe.Observer) Line {
+	p.Line = p.Line.Observe(observers...)
+	return p
+}
+
+// Job runs all Cmd filters in a process group of job, see Job. Cmd filters
+// wrapped by Redirect or Scope are in the job too, Cmd filters hidden by other
+// wrappers run outside of it.
+func (p Line) Job(job *Job) Line {
+	p.job = job
+	return p
+}
+
+// Run runs filters like pipe.Line.Run does. Adjacent Cmd filters are
+// connected by os.Pipe, so data go directly from one process to another
+// and the kernel can use splice. The first and last Cmd get stdin and
+// stdout directly if they are *os.File. Such streams are not observed.
 func (p Line) Run(ctx context.Context, stdio StandardIO, filters ...Filter) error {
-	pipeio := pipe.NewStdio[byte](stdio.Stdin(), stdio.Stdout(), stdio.Stderr())
+	filters, files, err := direct(stdio, filters)
+	if err != nil {
+		return pipe.NewError(1, err)
+	}
+	var slots []*jobSlot
+	if p.job != nil {
+		slots = p.withJob(filters)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	pipeio := toPipe(stdio)
 	pipefilters := make([]pipe.Filter[byte], len(filters))
 	for idx, f := range filters {
-		pipefilters[idx] = pipeFilter{filter: f}
+		var slot *jobSlot
+		if slots != nil {
+			slot = slots[idx]
+		}
+		pipefilters[idx] = pipeFilter{filter: f, slot: slot}
 	}
 
 	return p.Line.Run(ctx, pipeio, pipefilters...)
 }
 
+// direct returns a copy of filters where Cmd filters get *os.File stdin and
+// stdout if possible. It returns all created os.Pipe files, so they can be
+// closed even if a Cmd does not run.
+func direct(stdio StandardIO, filters []Filter) ([]Filter, []*os.File, error) {
+	if len(filters) == 0 {
+		return filters, nil, nil
+	}
+	ret := slices.Clone(filters)
+	last := len(ret) - 1
+	if cmd, ok := ret[0].(Cmd); ok {
+		if f, ok := stdio.Stdin().(*os.File); ok {
+			cmd.stdin = f
+			ret[0] = cmd
+		}
+	}
+	if cmd, ok := ret[last].(Cmd); ok {
+		if f, ok := stdio.Stdout().(*os.File); ok {
+			cmd.stdout = f
+			ret[last] = cmd
+		}
+	}
+
+	var files []*os.File
+	for idx := 0; idx < last; idx++ {
+		a, ok := ret[idx].(Cmd)
+		if !ok {
+			continue
+		}
+		b, ok := ret[idx+1].(Cmd)
+		if !ok {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, err
+		}
+		a.stdout = w
+		a.owned = append(a.owned, w)
+		b.stdin = r
+		b.owned = append(b.owned, r)
+		ret[idx], ret[idx+1] = a, b
+		files = append(files, r, w)
+	}
+	return ret, files, nil
+}
+
+// withJob sets the job to all Cmd filters, including ones wrapped by Redirect
+// or Scope. It returns a job slot of each filter, nil if there is no Cmd.
+func (p Line) withJob(filters []Filter) []*jobSlot {
+	slots := make([]*jobSlot, len(filters))
+	n := 0
+	for idx, f := range filters {
+		slot := &jobSlot{job: p.job}
+		if f, ok := joinJob(f, slot); ok {
+			filters[idx] = f
+			slots[idx] = slot
+			n++
+		}
+	}
+	p.job.expect(n)
+	return slots
+}
+
+// joinJob sets the job slot to a Cmd or to a Cmd wrapped by Redirect or Scope
+func joinJob(filter Filter, slot *jobSlot) (Filter, bool) {
+	switch f := filter.(type) {
+	case Cmd:
+		f.job = slot.job
+		f.slot = slot
+		return f, true
+	case redirected:
+		inner, ok := joinJob(f.filter, slot)
+		f.filter = inner
+		return f, ok
+	case scoped:
+		inner, ok := joinJob(f.filter, slot)
+		f.filter = inner
+		return f, ok
+	}
+	return filter, false
+}
+
+// Describe renders the filters like a shell does, so cat | grep foo | wc -l
+func Describe(filters ...Filter) string {
+	pipefilters := make([]pipe.Filter[byte], len(filters))
+	for idx, f := range filters {
+		pipefilters[idx] = pipeFilter{filter: f}
+	}
+	return pipe.Describe(pipefilters...)
+}
+
 type pipeFilter struct {
 	filter Filter
+	slot   *jobSlot
+}
+
+// Name returns a name of wrapped filter if it is pipe.Named
+func (f pipeFilter) Name() string {
+	if n, ok := f.filter.(pipe.Named); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+func (f pipeFilter) Unwrap() any {
+	return f.filter
 }
 
 func (f pipeFilter) Run(ctx context.Context, stdio pipe.StandardIO[byte]) error {
-	unixio := NewStdio(stdio.Stdin(), stdio.Stdout(), stdio.Stderr())
-	return f.filter.Run(ctx, unixio)
+	// a wrapper can return before the Cmd runs
+	defer f.slot.leave()
+	return f.filter.Run(ctx, fromPipe(stdio))
 }